@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/76creates/runner-cli/ghCtl"
+	"github.com/76creates/runner-cli/ghRunnerCtl"
+	"github.com/76creates/runner-cli/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"strings"
+)
+
+// Config is the gh-runner-ctl configuration, values are read with the following precedence:
+// flags, GH_RUNNER_CTL_ prefixed env vars, the config file, and the defaults
+type Config struct {
+	Github ghCtl.Config `mapstructure:"github"`
+	Tend ghRunnerCtl.Config `mapstructure:"tend"`
+	Log log.Config `mapstructure:"log"`
+}
+
+// configKeys are registered with viper so the env vars are picked up on the Unmarshal,
+// viper only looks up the env for the keys it knows about
+var configKeys = []string{
+	"github.token",
+	"github.app.id",
+	"github.app.installation-id",
+	"github.app.private-key",
+	"github.app.private-key-file",
+	"github.owner",
+	"github.repo",
+	"github.org",
+	"github.url",
+	"github.api-url",
+	"github.ca-bundle",
+	"github.timeouts.runner-spawn",
+	"github.timeouts.runner-active",
+	"github.timeouts.poll-interval",
+	"tend.poll-interval",
+	"tend.max-retry",
+	"tend.pickup-timeout",
+	"log.debug",
+	"log.format",
+}
+
+// bindFlag binds the flag to the config key, it panics if the flag does not exist
+func bindFlag(key string, cmd *cobra.Command, flag string) {
+	f := cmd.Flags().Lookup(flag)
+	if f == nil {
+		f = cmd.PersistentFlags().Lookup(flag)
+	}
+	if f == nil {
+		panic("flag " + flag + " does not exist")
+	}
+	if err := viper.BindPFlag(key, f); err != nil {
+		panic(err)
+	}
+}
+
+// loadConfig reads the config file if one is set or found in the working directory
+// and decodes the config, GitHub Actions env vars are used as a fallback
+func loadConfig() (*Config, error) {
+	viper.SetEnvPrefix("GH_RUNNER_CTL")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	viper.AutomaticEnv()
+	for _, key := range configKeys {
+		viper.SetDefault(key, nil)
+	}
+
+	if configFile := viper.GetString("config"); configFile != "" {
+		viper.SetConfigFile(configFile)
+	} else {
+		viper.SetConfigName("gh-runner-ctl")
+		viper.SetConfigType("yaml")
+		viper.AddConfigPath(".")
+	}
+	if err := viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return nil, err
+		}
+	}
+
+	// values that GitHub Actions set, used only when not configured otherwise
+	viper.BindEnv("github.token-fallback", "GITHUB_TOKEN")
+	viper.BindEnv("github.repository", "GITHUB_REPOSITORY")
+	if !viper.IsSet("github.token") && viper.GetString("github.token-fallback") != "" {
+		viper.Set("github.token", viper.GetString("github.token-fallback"))
+	}
+	if repository := viper.GetString("github.repository"); repository != "" {
+		s := strings.SplitN(repository, "/", 2)
+		if len(s) == 2 {
+			if viper.GetString("github.owner") == "" {
+				viper.Set("github.owner", s[0])
+			}
+			if viper.GetString("github.repo") == "" {
+				viper.Set("github.repo", s[1])
+			}
+		}
+	}
+	if viper.GetString("log.format") == "" && viper.GetBool("github.actions") {
+		viper.Set("log.format", log.FormatActions)
+	}
+
+	c := new(Config)
+	if err := viper.Unmarshal(c); err != nil {
+		return nil, err
+	}
+	if err := c.Github.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Tend.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -17,10 +17,14 @@ var (
 func Init() {
 	rootCmd.PersistentFlags().Bool("github.actions", false, "tell script that you are running inside a runner")
 	rootCmd.PersistentFlags().BoolP("debug", "d", false, "show debug messages")
+	rootCmd.PersistentFlags().String("log-format", "", "log format, text or actions, actions is used by default when running inside a runner")
+	rootCmd.PersistentFlags().StringP("config", "c", "", "location of the gh-runner-ctl config yaml, gh-runner-ctl.yaml from the working directory is used if found")
 
 	viper.BindPFlag("github.actions", rootCmd.PersistentFlags().Lookup("github.actions"))
 	viper.BindEnv("github.actions", strings.ReplaceAll("github.actions", ".", "_"), "GITHUB_ACTIONS")
-	viper.BindPFlag("debug", rootCmd.PersistentFlags().Lookup("debug"))
+	bindFlag("log.debug", rootCmd, "debug")
+	bindFlag("log.format", rootCmd, "log-format")
+	bindFlag("config", rootCmd, "config")
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatal(err)
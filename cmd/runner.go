@@ -1,18 +1,39 @@
 package cmd
 
 import (
-	"context"
+	"github.com/76creates/runner-cli/ghCtl"
+	"github.com/76creates/runner-cli/log"
 	"github.com/spf13/cobra"
 )
 
+var (
+	config *Config
+	ghClient *ghCtl.Client
+)
+
 func init() {
-	runnerCmd.PersistentFlags().String("github-token", "", "github token, must have repo scope")
-	runnerCmd.MarkPersistentFlagRequired("github-token")
+	runnerCmd.PersistentFlags().String("github-token", "", "github token, must have repo scope, GITHUB_TOKEN is used if empty")
 	// TODO: check if binary is in repo and extract automatically
-	runnerCmd.PersistentFlags().String("github-repo-owner", "", "github repo owner string")
-	runnerCmd.MarkPersistentFlagRequired("github-repo-owner")
-	runnerCmd.PersistentFlags().String("github-repo-name", "", "github repo name string")
-	runnerCmd.MarkPersistentFlagRequired("github-repo-name")
+	runnerCmd.PersistentFlags().String("github-repo-owner", "", "github repo owner string, taken from GITHUB_REPOSITORY if empty")
+	runnerCmd.PersistentFlags().String("github-repo-name", "", "github repo name string, taken from GITHUB_REPOSITORY if empty")
+	runnerCmd.PersistentFlags().String("github-org", "", "register runners with the organisation instead of the repository")
+	runnerCmd.PersistentFlags().String("github-url", "", "github enterprise server url e.g. https://ghes.example.com, github.com is used if empty")
+	runnerCmd.PersistentFlags().String("github-api-url", "", "github enterprise server api url, derived from the github-url if empty")
+	runnerCmd.PersistentFlags().String("github-ca-bundle", "", "path to the PEM CA bundle trusted when talking to the github server")
+	runnerCmd.PersistentFlags().Int64("github-app-id", 0, "github app id, app installation token is used instead of the github token if set")
+	runnerCmd.PersistentFlags().Int64("github-app-installation-id", 0, "github app installation id")
+	runnerCmd.PersistentFlags().String("github-app-private-key-file", "", "path to the github app private key")
+
+	bindFlag("github.token", runnerCmd, "github-token")
+	bindFlag("github.owner", runnerCmd, "github-repo-owner")
+	bindFlag("github.repo", runnerCmd, "github-repo-name")
+	bindFlag("github.org", runnerCmd, "github-org")
+	bindFlag("github.url", runnerCmd, "github-url")
+	bindFlag("github.api-url", runnerCmd, "github-api-url")
+	bindFlag("github.ca-bundle", runnerCmd, "github-ca-bundle")
+	bindFlag("github.app.id", runnerCmd, "github-app-id")
+	bindFlag("github.app.installation-id", runnerCmd, "github-app-installation-id")
+	bindFlag("github.app.private-key-file", runnerCmd, "github-app-private-key-file")
 
 	rootCmd.AddCommand(runnerCmd)
 }
@@ -20,10 +41,16 @@ func init() {
 var runnerCmd = &cobra.Command{
 	Use:   "runner",
 	Short: "subcommand for runner actions",
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		ctx = context.WithValue(ctx, "github-token", cmd.Flag("github-token").Value.String())
-		ctx = context.WithValue(ctx, "github-repo-owner", cmd.Flag("github-repo-owner").Value.String())
-		ctx = context.WithValue(ctx, "github-repo-name", cmd.Flag("github-repo-name").Value.String())
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		config, err = loadConfig()
+		if err != nil {
+			return err
+		}
+		log.Configure(config.Log)
+
+		ghClient, err = ghCtl.NewClient(ctx, config.Github)
+		return err
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return cmd.Help()
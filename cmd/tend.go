@@ -5,6 +5,7 @@ import (
 	deindent "github.com/76creates/de-indent"
 	"github.com/76creates/runner-cli/ghRunnerCtl"
 	"github.com/76creates/runner-cli/log"
+	"github.com/76creates/runner-cli/provider"
 	"github.com/spf13/cobra"
 	"os"
 	"strconv"
@@ -14,6 +15,10 @@ func init() {
 	runnerTendCmd.Flags().String("conf", "", "location of the runner configuration yaml")
 	runnerTendCmd.Flags().String("github-workflow-run-id", "", "workflow run ID to †end to")
 	runnerTendCmd.MarkFlagRequired("github-workflow-run-id")
+	runnerTendCmd.Flags().Bool("dry-run", false, "print the plan for the queued jobs without creating any runner")
+	runnerTendCmd.Flags().Duration("poll-interval", 0, "interval between the workflow run checks, 20s if not set")
+
+	bindFlag("tend.poll-interval", runnerTendCmd, "poll-interval")
 
 	runnerCmd.AddCommand(runnerTendCmd)
 }
@@ -39,12 +44,11 @@ var runnerTendCmd = &cobra.Command{
 
 		var runnerConfig *ghRunnerCtl.RunnerConfig
 		if cmd.Flag("conf").Value.String() != "" {
-			runnerConfigFile, err := os.Open(cmd.Flag("conf").Value.String())
-			if err != nil {
+			if _, err := os.Stat(cmd.Flag("conf").Value.String()); err != nil {
 				log.Error(err.Error())
 				return err
 			}
-			runnerConfig = ghRunnerCtl.Parse(runnerConfigFile)
+			runnerConfig = ghRunnerCtl.ParseFile(cmd.Flag("conf").Value.String())
 		} else {
 			// read stdin if not empty
 			in, err := os.Stdin.Stat()
@@ -60,7 +64,20 @@ var runnerTendCmd = &cobra.Command{
 			return errors.New("could not find config")
 		}
 
-		tend := ghRunnerCtl.Tend{}
-		return tend.Start(ctx, workflowRunID, runnerConfig)
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+
+		// provider clients are cached for the whole tend, Start returns only once the jobs using
+		// them are done so they are closed after the last use
+		defer func() {
+			if err := provider.Close(); err != nil {
+				log.Warning(err.Error())
+			}
+		}()
+
+		tend := ghRunnerCtl.Tend{DryRun: dryRun, Config: config.Tend}
+		return tend.Start(ctx, ghClient, workflowRunID, runnerConfig)
 	},
 }
@@ -0,0 +1,125 @@
+package ghCtl
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/76creates/runner-cli/log"
+	"github.com/76creates/runner-cli/secret"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	"time"
+)
+
+// appTokenSource mints installation tokens for the GitHub App, it is meant to be wrapped
+// with the oauth2.ReuseTokenSource so token is only minted when the previous one expires
+type appTokenSource struct {
+	ctx context.Context
+	app AppConfig
+	apiURL string
+	key *rsa.PrivateKey
+}
+
+func newAppTokenSource(ctx context.Context, app AppConfig, apiURL string) (*appTokenSource, error) {
+	keyPEM := app.PrivateKey.Value()
+	if keyPEM == "" {
+		content, err := ioutil.ReadFile(app.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the github app private key: %w", err)
+		}
+		keyPEM = string(content)
+		// key read from the file is redacted the same as the one set in the config
+		secret.Register(keyPEM)
+	}
+
+	key, err := parseRSAPrivateKey([]byte(keyPEM))
+	if err != nil {
+		return nil, err
+	}
+
+	return &appTokenSource{ctx: ctx, app: app, apiURL: apiURL, key: key}, nil
+}
+
+// Token mints new installation token using the App JWT
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	log.Debug("minting github app installation token")
+
+	jwt, err := s.jwt()
+	if err != nil {
+		return nil, err
+	}
+
+	// app endpoints are authenticated with the JWT instead of the installation token
+	jwtClient := oauth2.NewClient(s.ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: jwt}))
+	gh, err := newGithubClient(jwtClient, s.apiURL)
+	if err != nil {
+		return nil, err
+	}
+
+	token, resp, err := gh.Apps.CreateInstallationToken(s.ctx, s.app.InstallationID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 201 {
+		return nil, fmt.Errorf("didnt get expected status code(201), got %d", resp.StatusCode)
+	}
+
+	secret.Register(token.GetToken())
+	return &oauth2.Token{AccessToken: token.GetToken(), Expiry: token.GetExpiresAt()}, nil
+}
+
+// jwt returns RS256 signed JWT for the App, valid for 9 minutes, issued a minute in the past
+// to allow for the clock drift as GitHub recommends
+func (s *appTokenSource) jwt() (string, error) {
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(time.Minute * 9).Unix(),
+		"iss": s.app.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseRSAPrivateKey parses PKCS1 or PKCS8 PEM encoded RSA key, GitHub issues PKCS1 ones
+func parseRSAPrivateKey(keyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("github app private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the github app private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("github app private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
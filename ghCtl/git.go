@@ -2,44 +2,242 @@ package ghCtl
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"github.com/76creates/runner-cli/log"
+	"github.com/76creates/runner-cli/secret"
 	"github.com/google/go-github/v39/github"
 	"golang.org/x/oauth2"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
 )
 
-// InitClient fetch the github auth client
+// DefaultServerURL is the GitHub server the runners register with
+const DefaultServerURL = "https://github.com"
+
+// Config holds the GitHub settings, it is decoded from the github namespace of the config
+type Config struct {
+	// Token personal access or actions token, must have repo scope, ignored if the App is set
+	Token secret.Secret `mapstructure:"token"`
+	App AppConfig `mapstructure:"app"`
+
+	// Owner and Repo of the repository whose workflow runs are tended
+	Owner string `mapstructure:"owner"`
+	Repo string `mapstructure:"repo"`
+	// Org registers runners on the organisation level instead of the repository one
+	Org string `mapstructure:"org"`
+
+	// URL of the GitHub enterprise server e.g. https://ghes.example.com, github.com is used if empty
+	URL string `mapstructure:"url"`
+	// APIURL of the GitHub enterprise server, derived from the URL if empty
+	APIURL string `mapstructure:"api-url"`
+	// CABundle path to the PEM CA bundle trusted when talking to the GitHub server
+	CABundle string `mapstructure:"ca-bundle"`
+
+	Timeouts Timeouts `mapstructure:"timeouts"`
+}
+
+// AppConfig GitHub App credentials, installation token is minted and refreshed from these
+type AppConfig struct {
+	ID int64 `mapstructure:"id"`
+	InstallationID int64 `mapstructure:"installation-id"`
+	PrivateKey secret.Secret `mapstructure:"private-key"`
+	PrivateKeyFile string `mapstructure:"private-key-file"`
+}
+
+// Timeouts for the operations waiting on the runners
+type Timeouts struct {
+	// RunnerSpawn how long to wait for the runner to register
+	RunnerSpawn time.Duration `mapstructure:"runner-spawn"`
+	// RunnerActive how long to wait for the registered runner to come online
+	RunnerActive time.Duration `mapstructure:"runner-active"`
+	// PollInterval between the GitHub API calls when waiting
+	PollInterval time.Duration `mapstructure:"poll-interval"`
+}
+
+// Validate checks the config and fills in the defaults
+func (cfg *Config) Validate() error {
+	if cfg.Owner == "" || cfg.Repo == "" {
+		return errors.New("github repo owner and name must be set")
+	}
+	if cfg.Token == "" && cfg.App.ID == 0 {
+		return errors.New("either github token or github app must be set")
+	}
+	if cfg.URL == "" && cfg.APIURL != "" && serverURLFromAPIURL(cfg.APIURL) == "" {
+		return errors.New("github url must be set when the api url is not in the <server>/api/v3 form")
+	}
+	if cfg.App.ID != 0 {
+		if cfg.App.InstallationID == 0 {
+			return errors.New("github app installation id must be set")
+		}
+		if cfg.App.PrivateKey == "" && cfg.App.PrivateKeyFile == "" {
+			return errors.New("github app private key or private key file must be set")
+		}
+	}
+
+	if cfg.Timeouts.RunnerSpawn == 0 {
+		cfg.Timeouts.RunnerSpawn = time.Minute * 2
+	}
+	if cfg.Timeouts.RunnerActive == 0 {
+		cfg.Timeouts.RunnerActive = time.Minute * 2
+	}
+	if cfg.Timeouts.PollInterval == 0 {
+		cfg.Timeouts.PollInterval = time.Second * 10
+	}
+
+	secret.Register(cfg.Token.Value())
+	secret.Register(cfg.App.PrivateKey.Value())
+	return nil
+}
+
+// Client is the GitHub client scoped to the repository, and organisation if the runners are
+// registered on the organisation level
+type Client struct {
+	github *github.Client
+	config Config
+	// caBundle PEM content of the configured CA bundle, passed on to the runners
+	caBundle string
+}
+
+// NewClient creates the github auth client, if the url or api-url is set the enterprise
+// server client is created instead of the github.com one
 // this function does not check the validity of the token
-func InitClient(ctx context.Context) *github.Client {
+func NewClient(ctx context.Context, cfg Config) (*Client, error) {
 	log.Debug("initializing github client")
-	token := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: getToken(ctx)},
-	)
+
+	c := &Client{config: cfg}
+
+	if cfg.CABundle != "" {
+		pem, err := ioutil.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the CA bundle: %w", err)
+		}
+		httpClient, err := httpClientWithCABundle(cfg.CABundle, pem)
+		if err != nil {
+			return nil, err
+		}
+		// oauth2 client uses this client as a base transport
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+		c.caBundle = string(pem)
+	}
+
+	var token oauth2.TokenSource
+	if cfg.App.ID != 0 {
+		appToken, err := newAppTokenSource(ctx, cfg.App, c.APIURL())
+		if err != nil {
+			return nil, err
+		}
+		token = oauth2.ReuseTokenSource(nil, appToken)
+	} else {
+		token = oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: cfg.Token.Value()},
+		)
+	}
 	o2Client := oauth2.NewClient(ctx, token)
 
-	return github.NewClient(o2Client)
+	gh, err := newGithubClient(o2Client, c.APIURL())
+	if err != nil {
+		return nil, err
+	}
+	c.github = gh
+	return c, nil
+}
+
+// newGithubClient returns github.com client if the apiURL is empty, enterprise server one otherwise
+func newGithubClient(httpClient *http.Client, apiURL string) (*github.Client, error) {
+	if apiURL == "" {
+		return github.NewClient(httpClient), nil
+	}
+
+	log.DebugF("using github enterprise server api %q", apiURL)
+	return github.NewEnterpriseClient(apiURL, enterpriseUploadURL(apiURL), httpClient)
+}
+
+// httpClientWithCABundle returns http client that trusts the certificates from the bundle
+// on top of the system ones
+func httpClientWithCABundle(caBundle string, pem []byte) (*http.Client, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in the CA bundle %q", caBundle)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: transport}, nil
+}
+
+// enterpriseUploadURL derives the uploads url from the api one e.g.
+// https://ghes.example.com/api/v3/ -> https://ghes.example.com/api/uploads/
+func enterpriseUploadURL(apiURL string) string {
+	base := strings.TrimSuffix(strings.TrimSuffix(apiURL, "/"), "/api/v3")
+	return base + "/api/uploads/"
+}
+
+// ServerURL returns the GitHub server url, if only the api url is set server url is derived from it,
+// github.com is returned if no enterprise server is set
+func (c *Client) ServerURL() string {
+	if c.config.URL != "" {
+		return strings.TrimSuffix(c.config.URL, "/")
+	}
+	if c.config.APIURL != "" {
+		if url := serverURLFromAPIURL(c.config.APIURL); url != "" {
+			return url
+		}
+	}
+	return DefaultServerURL
+}
+
+// serverURLFromAPIURL derives the server url from the api one e.g.
+// https://ghes.example.com/api/v3/ -> https://ghes.example.com, empty string is returned if it can not be derived
+func serverURLFromAPIURL(apiURL string) string {
+	api := strings.TrimSuffix(apiURL, "/")
+	if api == "https://api.github.com" {
+		return DefaultServerURL
+	}
+	if !strings.HasSuffix(api, "/api/v3") {
+		return ""
+	}
+	return strings.TrimSuffix(api, "/api/v3")
 }
 
-// getClient extract github.Client from the context
-func getClient(ctx context.Context) *github.Client {
-	return ctx.Value("client").(*github.Client)
+// APIURL returns the enterprise server api url, if only the server url is set api url is derived
+// from it, empty string is returned when github.com is used
+func (c *Client) APIURL() string {
+	if c.config.APIURL != "" {
+		return c.config.APIURL
+	}
+	if url := c.ServerURL(); url != DefaultServerURL {
+		return url + "/api/v3/"
+	}
+	return ""
 }
 
-// getToken extract github action token from the context
-func getToken(ctx context.Context) string {
-	return ctx.Value("github-token").(string)
+// Repository returns the repository in the owner/name format
+func (c *Client) Repository() string {
+	return fmt.Sprintf("%s/%s", c.config.Owner, c.config.Repo)
 }
 
-// GetRepoOwner extract repo owner string from the context
-func GetRepoOwner(ctx context.Context) string {
-	return ctx.Value("github-repo-owner").(string)
+// RegistrationURL returns the url runners register with, the organisation or the repository one
+func (c *Client) RegistrationURL() string {
+	if c.config.Org != "" {
+		return fmt.Sprintf("%s/%s", c.ServerURL(), c.config.Org)
+	}
+	return fmt.Sprintf("%s/%s", c.ServerURL(), c.Repository())
 }
 
-// GetRepoName extract repo name string from the context
-func GetRepoName(ctx context.Context) string {
-	return ctx.Value("github-repo-name").(string)
+// CABundle returns the PEM content of the configured CA bundle, empty if none is set
+func (c *Client) CABundle() string {
+	return c.caBundle
 }
 
-// GetRegistrationToken extract the registration token for the runner
-func GetRegistrationToken(ctx context.Context) string {
-	return ctx.Value("github-registration-token").(string)
+// Timeouts returns the configured timeouts
+func (c *Client) Timeouts() Timeouts {
+	return c.config.Timeouts
 }
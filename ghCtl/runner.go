@@ -15,13 +15,17 @@ type Runner struct {
 
 // GenerateRunnerToken generates registration token which is used on the self hosted runner
 // in order to register it, returns token string
-func GenerateRunnerToken(ctx context.Context) (string, error) {
-	log.Debug("generating gitlab runner registration token")
-	c := getClient(ctx)
-
-	token, resp, err := c.Actions.CreateRegistrationToken(
-		ctx, GetRepoOwner(ctx), GetRepoName(ctx),
-	)
+func (c *Client) GenerateRunnerToken(ctx context.Context) (string, error) {
+	log.Debug("generating github runner registration token")
+
+	var token *github.RegistrationToken
+	var resp *github.Response
+	var err error
+	if c.config.Org != "" {
+		token, resp, err = c.github.Actions.CreateOrganizationRegistrationToken(ctx, c.config.Org)
+	} else {
+		token, resp, err = c.github.Actions.CreateRegistrationToken(ctx, c.config.Owner, c.config.Repo)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -34,15 +38,58 @@ func GenerateRunnerToken(ctx context.Context) (string, error) {
 	return token.GetToken(), nil
 }
 
+// GenerateRunnerJITConfig creates the just-in-time runner config, runner is registered upfront
+// with the name and labels provided and serves a single job only, returns the encoded config
+// which is passed to the run.sh --jitconfig
+func (c *Client) GenerateRunnerJITConfig(ctx context.Context, name string, labels []string, runnerGroupID int64) (string, error) {
+	log.DebugF("generating github runner jit config for the runner %q", name)
+
+	// go-github v39 has no generate-jitconfig API, the endpoint was added to the library later on,
+	// so the request is built with the client directly to keep the auth, base url and error handling
+	u := fmt.Sprintf("repos/%v/%v/actions/runners/generate-jitconfig", c.config.Owner, c.config.Repo)
+	if c.config.Org != "" {
+		u = fmt.Sprintf("orgs/%v/actions/runners/generate-jitconfig", c.config.Org)
+	}
+	body := map[string]interface{}{
+		"name":            name,
+		"runner_group_id": runnerGroupID,
+		"labels":          labels,
+	}
+	req, err := c.github.NewRequest("POST", u, body)
+	if err != nil {
+		return "", err
+	}
+
+	jitConfig := new(struct {
+		EncodedJITConfig string `json:"encoded_jit_config"`
+	})
+	resp, err := c.github.Do(ctx, req, jitConfig)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != 201 {
+		return "", errors.New(
+			fmt.Sprintf("Didnt get expected status code(201), got %d", resp.StatusCode),
+		)
+	}
+
+	return jitConfig.EncodedJITConfig, nil
+}
+
+// GetRunner returns the runner with the name or label provided
+func (c *Client) GetRunner(ctx context.Context, label string) (*github.Runner, error) {
+	return c.getOneRunnerByLabel(ctx, label)
+}
+
 // WaitForRunnerToBecomeActive waits for runner to spawn, and the waits for it to
-// exit the offline state, each action timeouts after 2 minutes
-func WaitForRunnerToBecomeActive(ctx context.Context, label string) error {
-	runner, err := waitForLabeledRunnerToSpawn(ctx, label)
+// exit the offline state, each action timeouts as per the configured timeouts
+func (c *Client) WaitForRunnerToBecomeActive(ctx context.Context, label string) error {
+	runner, err := c.waitForLabeledRunnerToSpawn(ctx, label)
 	if err != nil {
 		return err
 	}
 
-	err = waitForRunnerStateActive(ctx, runner.GetID())
+	err = c.waitForRunnerStateActive(ctx, runner.GetID())
 	if err != nil {
 		return err
 	}
@@ -54,14 +101,14 @@ func WaitForRunnerToBecomeActive(ctx context.Context, label string) error {
 // WaitForRunnerToBecomeOffline waits for the runner to enter offline status
 // we would use this to know when the runner has ended its execution with the
 // ephemeral flag on
-func WaitForRunnerToBecomeOffline(ctx context.Context, label string) error {
-	runner, err := getOneRunnerByLabel(ctx, label)
+func (c *Client) WaitForRunnerToBecomeOffline(ctx context.Context, label string) error {
+	runner, err := c.getOneRunnerByLabel(ctx, label)
 	if err != nil {
 		return err
 	}
 
 	retryWait := time.Second*30
-	err = waitForRunnerStateEqual(ctx, "offline", runner.GetID(), 20, retryWait)
+	err = c.waitForRunnerStateEqual(ctx, "offline", runner.GetID(), 20, retryWait)
 	if err != nil {
 		return err
 	}
@@ -72,19 +119,19 @@ func WaitForRunnerToBecomeOffline(ctx context.Context, label string) error {
 
 // WaitForRunnerToBeDeRegistered waits for the runner to de-register itself,
 // that is we wait for the runner to go missing
-func WaitForRunnerToBeDeRegistered(ctx context.Context, label string, retryCount int, waitRetry time.Duration) error {
+func (c *Client) WaitForRunnerToBeDeRegistered(ctx context.Context, label string, retryCount int, waitRetry time.Duration) error {
 		log.DebugF("wait for runner with label '%q' to de-register", label)
 
 		// TODO: this here is a bit racy, runner in theory could finish faster than this
-		runner, err := getOneRunnerByLabel(ctx, label)
+		runner, err := c.getOneRunnerByLabel(ctx, label)
 		if err != nil {
 			return err
 		}
 
 		for retry := 0; retry < retryCount; retry++ {
-		_, err := getRunnerByID(ctx, runner.GetID())
+		_, err := c.getRunnerByID(ctx, runner.GetID())
 		if err != nil {
-			if _, ok := err.(*RunnerNotFound); !ok {
+			if _, ok := err.(*RunnerNotFound); ok {
 				log.Debug("runner not found, ergo de-registered")
 				return nil
 			}
@@ -98,49 +145,64 @@ func WaitForRunnerToBeDeRegistered(ctx context.Context, label string, retryCount
 }
 
 
-func ListRunnersLabeled(ctx context.Context) error {
-	runners, err := listRunnersLabeled(ctx, "on-demand")
+func (c *Client) ListRunnersLabeled(ctx context.Context) error {
+	runners, err := c.listRunnersLabeled(ctx, "on-demand")
 	if err != nil {
 		return err
 	}
 
 	for _, runner := range runners {
-		fmt.Printf("%s / %s\n", *runner.Name, *runner.Status)
+		log.DebugF("%s / %s", runner.GetName(), runner.GetStatus())
 	}
 
 	return nil
 }
 
-// listRunners return full list of runners
-// TODO: implement pagination
-func listRunners(ctx context.Context) ([]*github.Runner, error) {
-	c := getClient(ctx)
-
+// listRunners return full list of runners, all the pages are read
+func (c *Client) listRunners(ctx context.Context) ([]*github.Runner, error) {
+	var all []*github.Runner
 	opts := github.ListOptions{PerPage: 100}
-	runners, resp, err := c.Actions.ListRunners(
-		ctx, GetRepoOwner(ctx), GetRepoName(ctx), &opts)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != 200 {
-		return nil, errors.New(
-			fmt.Sprintf("Didnt get expected status code(200), got %d", resp.StatusCode),
-		)
-	}
+	for {
+		var runners *github.Runners
+		var resp *github.Response
+		var err error
+		if c.config.Org != "" {
+			runners, resp, err = c.github.Actions.ListOrganizationRunners(ctx, c.config.Org, &opts)
+		} else {
+			runners, resp, err = c.github.Actions.ListRunners(ctx, c.config.Owner, c.config.Repo, &opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != 200 {
+			return nil, errors.New(
+				fmt.Sprintf("Didnt get expected status code(200), got %d", resp.StatusCode),
+			)
+		}
 
-	return runners.Runners, nil
+		all = append(all, runners.Runners...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
 }
 
-// listRunnersLabeled return list of runners that contain a label
-func listRunnersLabeled(ctx context.Context, label string) ([]*github.Runner, error) {
+// listRunnersLabeled return list of runners that contain a label, runner name is matched as well
+// since the runners we create are named uniquely and templates do not have to add the name as a label
+func (c *Client) listRunnersLabeled(ctx context.Context, label string) ([]*github.Runner, error) {
 	var runnersLabeled []*github.Runner
 
-	runners, err := listRunners(ctx)
+	runners, err := c.listRunners(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, runner := range runners {
+		if runner.GetName() == label {
+			runnersLabeled = append(runnersLabeled, runner)
+			continue
+		}
 		for _, runnerLabel := range runner.Labels {
 			if runnerLabel.GetName() == label {
 				runnersLabeled = append(runnersLabeled, runner)
@@ -153,18 +215,21 @@ func listRunnersLabeled(ctx context.Context, label string) ([]*github.Runner, er
 }
 
 // removeRunner removes the github runner, this does not de-register the runner
-func removeRunner(ctx context.Context, runner *github.Runner) error {
-	c := getClient(ctx)
-
+func (c *Client) removeRunner(ctx context.Context, runner *github.Runner) error {
 	log.DebugF("attempting to remove runner with name/id: %q/%q", runner.GetName(), runner.GetID())
-	resp, err := c.Actions.RemoveRunner(
-		ctx, GetRepoOwner(ctx), GetRepoName(ctx), runner.GetID())
+	var resp *github.Response
+	var err error
+	if c.config.Org != "" {
+		resp, err = c.github.Actions.RemoveOrganizationRunner(ctx, c.config.Org, runner.GetID())
+	} else {
+		resp, err = c.github.Actions.RemoveRunner(ctx, c.config.Owner, c.config.Repo, runner.GetID())
+	}
 	if err != nil {
 		return err
 	}
-	if resp.StatusCode != 200 {
+	if resp.StatusCode != 204 {
 		return errors.New(
-			fmt.Sprintf("Didnt get expected status code(200), got %d", resp.StatusCode),
+			fmt.Sprintf("Didnt get expected status code(204), got %d", resp.StatusCode),
 		)
 	}
 
@@ -172,9 +237,30 @@ func removeRunner(ctx context.Context, runner *github.Runner) error {
 	return nil
 }
 
+// RemoveRunner removes the runner registration so it can not pick up any more jobs, this is
+// what makes sure a runner which was not configured as ephemeral does not outlive its job,
+// runner that is already gone is not an error
+func (c *Client) RemoveRunner(ctx context.Context, label string) error {
+	runners, err := c.listRunnersLabeled(ctx, label)
+	if err != nil {
+		return err
+	}
+	if len(runners) == 0 {
+		log.DebugF("runner %q is already de-registered", label)
+		return nil
+	}
+
+	for _, runner := range runners {
+		if err := c.removeRunner(ctx, runner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // removeRunnerLabeled removes the github runner with a label, this does not de-register the runners
-func removeRunnerLabeled(ctx context.Context, label string) error {
-	runners, err := listRunnersLabeled(ctx, label)
+func (c *Client) removeRunnerLabeled(ctx context.Context, label string) error {
+	runners, err := c.listRunnersLabeled(ctx, label)
 	if err != nil {
 		return err
 	}
@@ -186,26 +272,31 @@ func removeRunnerLabeled(ctx context.Context, label string) error {
 	log.DebugF("found %d runners with label %q", len(runners), label)
 
 	for _, runner := range runners {
-		removeRunner(ctx, runner)
+		c.removeRunner(ctx, runner)
 	}
 
 	return nil
 }
 
 // getRunnerByID fetches runner with by the ID
-func getRunnerByID(ctx context.Context, id int64) (*github.Runner, error) {
-	c := getClient(ctx)
-
+func (c *Client) getRunnerByID(ctx context.Context, id int64) (*github.Runner, error) {
 	log.DebugF("attempting to get the runner with the id: %d", id)
-	runner, resp, err := c.Actions.GetRunner(
-		ctx, GetRepoOwner(ctx), GetRepoName(ctx), id)
+	var runner *github.Runner
+	var resp *github.Response
+	var err error
+	if c.config.Org != "" {
+		runner, resp, err = c.github.Actions.GetOrganizationRunner(ctx, c.config.Org, id)
+	} else {
+		runner, resp, err = c.github.Actions.GetRunner(ctx, c.config.Owner, c.config.Repo, id)
+	}
+	// github client reports 404 as an error, runner is gone in that case
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, &RunnerNotFound{id: id}
+	}
 	if err != nil {
 		return nil, err
 	}
 	if resp.StatusCode != 200 {
-		if resp.StatusCode == 404 {
-			return nil, &RunnerNotFound{id: id}
-		}
 		return nil, errors.New(
 			fmt.Sprintf("Didnt get expected status code(200), got %d", resp.StatusCode),
 		)
@@ -217,8 +308,8 @@ func getRunnerByID(ctx context.Context, id int64) (*github.Runner, error) {
 
 // getOneRunnerByLabel tries to get one runner by label provided, this is useful
 // when getting a runner with a unique ID
-func getOneRunnerByLabel(ctx context.Context, label string) (*github.Runner, error) {
-	runners, err := listRunnersLabeled(ctx, label)
+func (c *Client) getOneRunnerByLabel(ctx context.Context, label string) (*github.Runner, error) {
+	runners, err := c.listRunnersLabeled(ctx, label)
 	if err != nil {
 		return nil, err
 	}
@@ -258,23 +349,26 @@ func (e *MultipleRunnersFound) Error() string {
 }
 
 // waitForLabeledRunnerToSpawn wait for runner to appear on the GH
-func waitForLabeledRunnerToSpawn(ctx context.Context, label string) (*github.Runner, error) {
+func (c *Client) waitForLabeledRunnerToSpawn(ctx context.Context, label string) (*github.Runner, error) {
 	log.DebugF("wait for runner labeled %q to spawn", label)
 
-	// try getting runner for 2 minutes
-	for retry := 0; retry < 12; retry++ {
-		runner, err := getOneRunnerByLabel(ctx, label)
+	// try getting runner until the spawn timeout
+	timeouts := c.Timeouts()
+	for retry := 0; retry < retryCount(timeouts.RunnerSpawn, timeouts.PollInterval); retry++ {
+		runner, err := c.getOneRunnerByLabel(ctx, label)
 		if err != nil {
-			log.Error(err.Error())
 			if _, ok := err.(*RunnerNotFound); !ok {
+				log.Error(err.Error())
 				return nil, err
 			}
 
-			time.Sleep(time.Second * 5)
+			// runner is expected to be missing until the instance boots
+			log.DebugF("runner labeled %q has not spawned yet", label)
+			time.Sleep(timeouts.PollInterval)
 			continue
 		}
 
-		log.Warning("success")
+		log.DebugF("runner labeled %q spawned", label)
 		return runner, nil
 	}
 
@@ -290,12 +384,13 @@ func (e *OperationTimeout) Error() string {
 }
 
 // waitForRunnerStateActive wait for a runner to enter active state, meaning its not offline
-func waitForRunnerStateActive(ctx context.Context, id int64) error {
+func (c *Client) waitForRunnerStateActive(ctx context.Context, id int64) error {
 	log.DebugF("wait for runner '%d' to exit 'offline' status", id)
 
-	// wait for runner to exit offline status for 2 minutes
-	for retry := 0; retry < 12; retry++ {
-		runner, err := getRunnerByID(ctx, id)
+	// wait for runner to exit offline status until the active timeout
+	timeouts := c.Timeouts()
+	for retry := 0; retry < retryCount(timeouts.RunnerActive, timeouts.PollInterval); retry++ {
+		runner, err := c.getRunnerByID(ctx, id)
 		if err != nil {
 			return err
 		}
@@ -305,18 +400,18 @@ func waitForRunnerStateActive(ctx context.Context, id int64) error {
 		}
 
 		log.DebugF("runner id '%d' status is %q", id, runner.GetStatus())
-		time.Sleep(time.Second * 10)
+		time.Sleep(timeouts.PollInterval)
 	}
 
 	return &OperationTimeout{operation: "wait for the runner to exit offline state"}
 }
 
 // waitForRunnerStateActive wait for a runner to enter a certain state state
-func waitForRunnerStateEqual(ctx context.Context, state string, id int64, retryCount int, waitRetry time.Duration) error {
+func (c *Client) waitForRunnerStateEqual(ctx context.Context, state string, id int64, retryCount int, waitRetry time.Duration) error {
 	log.DebugF("wait for runner '%d' to transition to 'offline' state", id)
 
 	for retry := 0; retry < retryCount; retry++ {
-		runner, err := getRunnerByID(ctx, id)
+		runner, err := c.getRunnerByID(ctx, id)
 		if err != nil {
 			return err
 		}
@@ -332,3 +427,11 @@ func waitForRunnerStateEqual(ctx context.Context, state string, id int64, retryC
 
 	return &OperationTimeout{operation: fmt.Sprintf("wait for the runner to enter %q state", state)}
 }
+
+// retryCount returns how many times to poll within the timeout, at least once
+func retryCount(timeout, interval time.Duration) int {
+	if interval <= 0 || timeout < interval {
+		return 1
+	}
+	return int(timeout / interval)
+}
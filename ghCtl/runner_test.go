@@ -0,0 +1,84 @@
+package ghCtl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// newRunnersServer serves the runners split into pages of the requested size, next page is linked
+// the way GitHub does it
+func newRunnersServer(t *testing.T, path string, total int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != path {
+			http.Error(w, "unexpected request "+req.URL.Path, http.StatusNotFound)
+			return
+		}
+		perPage, _ := strconv.Atoi(req.URL.Query().Get("per_page"))
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+
+		var runners []*github.Runner
+		for id := (page-1)*perPage + 1; id <= page*perPage && id <= total; id++ {
+			runners = append(runners, &github.Runner{ID: github.Int64(int64(id)), Name: github.String(fmt.Sprintf("runner-%d", id))})
+		}
+		if page*perPage < total {
+			next := *req.URL
+			query := next.Query()
+			query.Set("page", strconv.Itoa(page+1))
+			next.RawQuery = query.Encode()
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, req.Host, next.String()))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&github.Runners{TotalCount: total, Runners: runners})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestListRunnersReadsAllPages(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		path   string
+	}{
+		{name: "repository", config: Config{Owner: "owner", Repo: "repo"}, path: "/api/v3/repos/owner/repo/actions/runners"},
+		{name: "organisation", config: Config{Owner: "owner", Repo: "repo", Org: "org"}, path: "/api/v3/orgs/org/actions/runners"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRunnersServer(t, tt.path, 250)
+			gh, err := newGithubClient(server.Client(), server.URL+"/api/v3/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &Client{github: gh, config: tt.config}
+
+			runners, err := c.listRunners(context.Background())
+			if err != nil {
+				t.Fatalf("listRunners() unexpected error: %v", err)
+			}
+			if len(runners) != 250 {
+				t.Fatalf("listRunners() returned %d runners, want 250", len(runners))
+			}
+
+			// runner past the first page is found by its name
+			runner, err := c.getOneRunnerByLabel(context.Background(), "runner-230")
+			if err != nil {
+				t.Fatalf("getOneRunnerByLabel() unexpected error: %v", err)
+			}
+			if runner.GetID() != 230 {
+				t.Errorf("getOneRunnerByLabel() = %d, want 230", runner.GetID())
+			}
+		})
+	}
+}
@@ -8,13 +8,35 @@ import (
 	"github.com/google/go-github/v39/github"
 )
 
-func GetWorkflowRunWithTheID(ctx context.Context, workflowRunID int64) (*github.WorkflowRun, error) {
-	log.Debug("getting workflow run")
+// WorkflowJob extends the github.WorkflowJob with the runner fields that the go-github
+// version in use does not decode yet
+type WorkflowJob struct {
+	github.WorkflowJob
+	RunnerID *int64 `json:"runner_id,omitempty"`
+	RunnerName *string `json:"runner_name,omitempty"`
+}
+
+// GetRunnerName returns the name of the runner the job was assigned to, empty while the job is queued
+func (j *WorkflowJob) GetRunnerName() string {
+	if j == nil || j.RunnerName == nil {
+		return ""
+	}
+	return *j.RunnerName
+}
 
-	c := getClient(ctx)
+// GetRunnerID returns the id of the runner the job was assigned to, 0 while the job is queued
+func (j *WorkflowJob) GetRunnerID() int64 {
+	if j == nil || j.RunnerID == nil {
+		return 0
+	}
+	return *j.RunnerID
+}
+
+func (c *Client) GetWorkflowRunWithTheID(ctx context.Context, workflowRunID int64) (*github.WorkflowRun, error) {
+	log.Debug("getting workflow run")
 
-	run, resp, err := c.Actions.GetWorkflowRunByID(
-		ctx, GetRepoOwner(ctx), GetRepoName(ctx), workflowRunID)
+	run, resp, err := c.github.Actions.GetWorkflowRunByID(
+		ctx, c.config.Owner, c.config.Repo, workflowRunID)
 	if err != nil {
 		return nil, err
 	}
@@ -26,14 +48,12 @@ func GetWorkflowRunWithTheID(ctx context.Context, workflowRunID int64) (*github.
 	return run, nil
 }
 
-func GetQueuedWorkflowRunJobs(ctx context.Context, run *github.WorkflowRun) (*github.Jobs, error) {
+func (c *Client) GetQueuedWorkflowRunJobs(ctx context.Context, run *github.WorkflowRun) (*github.Jobs, error) {
 	// TODO: pagination
 	log.Debug("getting queued workflow run jobs")
 
-	c := getClient(ctx)
-
-	jobsAll, resp, err := c.Actions.ListWorkflowJobs(
-		ctx, GetRepoOwner(ctx), GetRepoName(ctx), run.GetID(), &github.ListWorkflowJobsOptions{})
+	jobsAll, resp, err := c.github.Actions.ListWorkflowJobs(
+		ctx, c.config.Owner, c.config.Repo, run.GetID(), &github.ListWorkflowJobsOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -55,13 +75,11 @@ func GetQueuedWorkflowRunJobs(ctx context.Context, run *github.WorkflowRun) (*gi
 	return jobsQueued, nil
 }
 
-func GetWorkflow(ctx context.Context, run *github.WorkflowRun) (*github.Workflow, error) {
+func (c *Client) GetWorkflow(ctx context.Context, run *github.WorkflowRun) (*github.Workflow, error) {
 	log.Debug("getting workflow file path")
 
-	c := getClient(ctx)
-
-	workflow, resp, err := c.Actions.GetWorkflowByID(
-		ctx, GetRepoOwner(ctx), GetRepoName(ctx), run.GetWorkflowID())
+	workflow, resp, err := c.github.Actions.GetWorkflowByID(
+		ctx, c.config.Owner, c.config.Repo, run.GetWorkflowID())
 	if err != nil {
 		return nil, err
 	}
@@ -71,3 +89,46 @@ func GetWorkflow(ctx context.Context, run *github.WorkflowRun) (*github.Workflow
 
 	return workflow, nil
 }
+
+// CancelWorkflowRun sends a cancellation request for the workflow run
+func (c *Client) CancelWorkflowRun(ctx context.Context, workflowRunID int64) error {
+	log.DebugF("cancelling workflow run with id: %d", workflowRunID)
+
+	resp, err := c.github.Actions.CancelWorkflowRunByID(
+		ctx, c.config.Owner, c.config.Repo, workflowRunID)
+	if err != nil {
+		// github client reports 202 as an error since the cancellation is processed asynchronously
+		if _, ok := err.(*github.AcceptedError); !ok {
+			return err
+		}
+	}
+	if resp.StatusCode != 202 {
+		return fmt.Errorf("didnt get expected status code(202), got %d", resp.StatusCode)
+	}
+
+	log.DebugF("successfully requested cancellation of the workflow run with id: %d", workflowRunID)
+	return nil
+}
+
+// GetWorkflowJob fetches the workflow job by the ID, request is made directly so the runner
+// the job was assigned to is decoded as well
+func (c *Client) GetWorkflowJob(ctx context.Context, jobID int64) (*WorkflowJob, error) {
+	log.DebugF("getting workflow job with id: %d", jobID)
+
+	u := fmt.Sprintf("repos/%v/%v/actions/jobs/%v", c.config.Owner, c.config.Repo, jobID)
+	req, err := c.github.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	job := new(WorkflowJob)
+	resp, err := c.github.Do(ctx, req, job)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("didnt get expected status code(200), got %d", resp.StatusCode)
+	}
+
+	return job, nil
+}
@@ -0,0 +1,29 @@
+package ghRunnerCtl
+
+import (
+	"context"
+	"github.com/76creates/runner-cli/ghCtl"
+	"github.com/google/go-github/v39/github"
+)
+
+// GithubClient is the part of the ghCtl.Client that tend relies on, it allows for the client to be
+// replaced with a fake when testing
+type GithubClient interface {
+	GetWorkflowRunWithTheID(ctx context.Context, workflowRunID int64) (*github.WorkflowRun, error)
+	GetQueuedWorkflowRunJobs(ctx context.Context, run *github.WorkflowRun) (*github.Jobs, error)
+	CancelWorkflowRun(ctx context.Context, workflowRunID int64) error
+	GetWorkflowJob(ctx context.Context, jobID int64) (*ghCtl.WorkflowJob, error)
+
+	GenerateRunnerToken(ctx context.Context) (string, error)
+	GenerateRunnerJITConfig(ctx context.Context, name string, labels []string, runnerGroupID int64) (string, error)
+	GetRunner(ctx context.Context, label string) (*github.Runner, error)
+	WaitForRunnerToBecomeActive(ctx context.Context, label string) error
+	RemoveRunner(ctx context.Context, label string) error
+
+	Repository() string
+	ServerURL() string
+	RegistrationURL() string
+	CABundle() string
+}
+
+var _ GithubClient = (*ghCtl.Client)(nil)
@@ -0,0 +1,156 @@
+package ghRunnerCtl
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/76creates/runner-cli/ghCtl"
+	"github.com/76creates/runner-cli/provider"
+	"github.com/google/go-github/v39/github"
+)
+
+// fakeGithubClient serves a single workflow job, runner that becomes active picks it up and completes
+// it right away unless pickedUpBy or noPickup say otherwise
+type fakeGithubClient struct {
+	mu sync.Mutex
+
+	job *github.WorkflowJob
+	// noPickup leaves the job queued
+	noPickup bool
+	// pickedUpBy name of the other runner that picks up the job
+	pickedUpBy string
+	// activeErr is returned while waiting for the runner to become active
+	activeErr error
+	// neverActive blocks waiting for the runner to become active until the context is done
+	neverActive bool
+
+	active  string
+	tokens  int
+	jit     map[string][]string
+	removed []string
+}
+
+var _ GithubClient = (*fakeGithubClient)(nil)
+
+func newFakeGithubClient(jobID int64, labels ...string) *fakeGithubClient {
+	return &fakeGithubClient{
+		job: &github.WorkflowJob{
+			ID:     github.Int64(jobID),
+			Name:   github.String("build"),
+			Status: github.String("queued"),
+			Labels: labels,
+		},
+		jit: make(map[string][]string),
+	}
+}
+
+func (c *fakeGithubClient) GetWorkflowRunWithTheID(_ context.Context, workflowRunID int64) (*github.WorkflowRun, error) {
+	return &github.WorkflowRun{ID: github.Int64(workflowRunID), Status: github.String("in_progress")}, nil
+}
+
+func (c *fakeGithubClient) GetQueuedWorkflowRunJobs(context.Context, *github.WorkflowRun) (*github.Jobs, error) {
+	return &github.Jobs{TotalCount: github.Int(1), Jobs: []*github.WorkflowJob{c.job}}, nil
+}
+
+func (c *fakeGithubClient) CancelWorkflowRun(context.Context, int64) error {
+	return nil
+}
+
+func (c *fakeGithubClient) GetWorkflowJob(_ context.Context, jobID int64) (*ghCtl.WorkflowJob, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if jobID != c.job.GetID() {
+		return nil, errors.New("unknown job")
+	}
+
+	job := &ghCtl.WorkflowJob{WorkflowJob: *c.job}
+	switch {
+	case c.pickedUpBy != "":
+		job.RunnerName = github.String(c.pickedUpBy)
+		job.Status = github.String("in_progress")
+	case c.active != "" && !c.noPickup:
+		job.RunnerName = github.String(c.active)
+		job.Status = github.String("completed")
+		job.Conclusion = github.String("success")
+	}
+	return job, nil
+}
+
+func (c *fakeGithubClient) GenerateRunnerToken(context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens++
+	return "registration-token", nil
+}
+
+func (c *fakeGithubClient) GenerateRunnerJITConfig(_ context.Context, name string, labels []string, _ int64) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.jit[name] = labels
+	return "jit-config", nil
+}
+
+func (c *fakeGithubClient) GetRunner(context.Context, string) (*github.Runner, error) {
+	return nil, &ghCtl.RunnerNotFound{}
+}
+
+func (c *fakeGithubClient) WaitForRunnerToBecomeActive(ctx context.Context, label string) error {
+	if c.neverActive {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.activeErr != nil {
+		return c.activeErr
+	}
+	c.active = label
+	return nil
+}
+
+func (c *fakeGithubClient) RemoveRunner(_ context.Context, label string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removed = append(c.removed, label)
+	return nil
+}
+
+func (c *fakeGithubClient) Repository() string      { return "owner/repo" }
+func (c *fakeGithubClient) ServerURL() string       { return ghCtl.DefaultServerURL }
+func (c *fakeGithubClient) RegistrationURL() string { return ghCtl.DefaultServerURL + "/owner/repo" }
+func (c *fakeGithubClient) CABundle() string        { return "" }
+
+// fakeProvider records the instances it creates and destroys
+type fakeProvider struct {
+	provider.BaseProvider
+
+	created   []string
+	destroyed []string
+}
+
+var _ provider.Provider = (*fakeProvider)(nil)
+
+func (p *fakeProvider) CreateInstance(_ context.Context, name string) error {
+	p.created = append(p.created, name)
+	return nil
+}
+
+func (p *fakeProvider) DestroyInstance(_ context.Context, name string) error {
+	p.destroyed = append(p.destroyed, name)
+	return nil
+}
+
+func (p *fakeProvider) InstanceStatus(context.Context, string) error {
+	return nil
+}
+
+func (p *fakeProvider) PlanInstance(context.Context, string) (*provider.InstancePlan, error) {
+	return &provider.InstancePlan{Provider: "fake"}, nil
+}
+
+func (p *fakeProvider) Clone() provider.Provider {
+	c := *p
+	return &c
+}
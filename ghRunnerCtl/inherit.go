@@ -0,0 +1,140 @@
+package ghRunnerCtl
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+)
+
+// rawBlock is a yaml block which is kept undecoded until inheritance is resolved
+type rawBlock = map[interface{}]interface{}
+
+const (
+	keyExtends = "extends"
+	keyAccess  = "access"
+)
+
+// resolveProviderBlock returns the provider block with the whole extends chain applied,
+// parent values are overridden by the child ones
+func resolveProviderBlock(providers map[string]rawBlock, name string, visited []string) (rawBlock, error) {
+	for _, v := range visited {
+		if v == name {
+			return nil, fmt.Errorf("provider %q extends itself through %v", name, visited)
+		}
+	}
+
+	block, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("could not find the %q provider in the providers object", name)
+	}
+
+	parentName, ok := block[keyExtends]
+	if !ok {
+		return copyBlock(block), nil
+	}
+	parentNameStr, ok := parentName.(string)
+	if !ok {
+		return nil, fmt.Errorf("provider %q has a non string extends value", name)
+	}
+
+	parent, err := resolveProviderBlock(providers, parentNameStr, append(visited, name))
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := mergeBlocks(parent, block)
+	delete(resolved, keyExtends)
+	return resolved, nil
+}
+
+// injectAccess places the named access block into every provider declared in the provider block,
+// access values declared in the provider itself take precedence over the shared ones
+func injectAccess(block rawBlock, accessBlocks map[string]rawBlock, accessName string) error {
+	access, ok := accessBlocks[accessName]
+	if !ok {
+		return fmt.Errorf("could not find the %q access in the access object", accessName)
+	}
+
+	for providerKey, providerConf := range block {
+		if providerKey == keyExtends || providerKey == keyAccess {
+			continue
+		}
+		conf, ok := providerConf.(rawBlock)
+		if !ok {
+			continue
+		}
+		sharedAccess, ok := access[providerKey].(rawBlock)
+		if !ok {
+			return fmt.Errorf("access %q has no %v credentials", accessName, providerKey)
+		}
+		ownAccess, _ := conf[keyAccess].(rawBlock)
+		conf[keyAccess] = mergeBlocks(sharedAccess, ownAccess)
+	}
+
+	return nil
+}
+
+// applyOverrides merges runner type overrides into every provider declared in the provider block
+func applyOverrides(block rawBlock, overrides rawBlock) {
+	if len(overrides) == 0 {
+		return
+	}
+	for providerKey, providerConf := range block {
+		if providerKey == keyExtends || providerKey == keyAccess {
+			continue
+		}
+		conf, ok := providerConf.(rawBlock)
+		if !ok {
+			continue
+		}
+		block[providerKey] = mergeBlocks(conf, overrides)
+	}
+}
+
+// decodeBlock decodes the resolved raw block into the typed object, decoding is strict so a misspelled
+// key in the provider block or the overrides is an error rather than silently falling back to the base value
+func decodeBlock(block rawBlock, out interface{}) error {
+	content, err := yaml.Marshal(block)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(content, out)
+}
+
+// mergeBlocks deep merges override into base and returns the new block, nested maps are merged
+// while every other value, lists included, is replaced
+func mergeBlocks(base, override rawBlock) rawBlock {
+	merged := copyBlock(base)
+	for k, v := range override {
+		baseMap, baseIsMap := merged[k].(rawBlock)
+		overrideMap, overrideIsMap := v.(rawBlock)
+		if baseIsMap && overrideIsMap {
+			merged[k] = mergeBlocks(baseMap, overrideMap)
+			continue
+		}
+		merged[k] = copyValue(v)
+	}
+	return merged
+}
+
+func copyBlock(block rawBlock) rawBlock {
+	c := make(rawBlock, len(block))
+	for k, v := range block {
+		c[k] = copyValue(v)
+	}
+	return c
+}
+
+func copyValue(v interface{}) interface{} {
+	switch n := v.(type) {
+	case rawBlock:
+		return copyBlock(n)
+	case []interface{}:
+		c := make([]interface{}, len(n))
+		for i, item := range n {
+			c[i] = copyValue(item)
+		}
+		return c
+	default:
+		return v
+	}
+}
@@ -0,0 +1,295 @@
+package ghRunnerCtl
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/76creates/runner-cli/provider/scaleway"
+	"gopkg.in/yaml.v2"
+)
+
+// parseTestConfig parses the config and turns the parse panic into an error
+func parseTestConfig(conf string) (c *RunnerConfig, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return ParseString(conf), nil
+}
+
+func mustBlocks(t *testing.T, content string) map[string]rawBlock {
+	t.Helper()
+	var blocks map[string]rawBlock
+	if err := yaml.Unmarshal([]byte(content), &blocks); err != nil {
+		t.Fatal(err)
+	}
+	return blocks
+}
+
+func TestResolveProviderBlockExtendsChain(t *testing.T) {
+	providers := mustBlocks(t, `
+base:
+  scaleway:
+    zone: fr-par-1
+    image: ubuntu
+    instance-type: DEV1-S
+    tags: [base]
+large:
+  extends: base
+  scaleway:
+    instance-type: GP1-M
+    tags: [large]
+large-ams:
+  extends: large
+  scaleway:
+    zone: nl-ams-1
+`)
+
+	got, err := resolveProviderBlock(providers, "large-ams", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rawBlock{"scaleway": mustBlocks(t, `
+scaleway:
+  zone: nl-ams-1
+  image: ubuntu
+  instance-type: GP1-M
+  tags: [large]
+`)["scaleway"]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveProviderBlock() = %#v, want %#v", got, want)
+	}
+
+	// resolving must not modify the declared blocks
+	if providers["base"]["scaleway"].(rawBlock)["zone"] != "fr-par-1" {
+		t.Error("parent block was modified while resolving the child")
+	}
+}
+
+func TestResolveProviderBlockErrors(t *testing.T) {
+	providers := mustBlocks(t, `
+a:
+  extends: b
+b:
+  extends: c
+c:
+  extends: a
+self:
+  extends: self
+orphan:
+  extends: missing
+bad:
+  extends: [a]
+`)
+
+	tests := []struct {
+		name    string
+		wantErr string
+	}{
+		{"a", `provider "a" extends itself`},
+		{"self", `provider "self" extends itself`},
+		{"orphan", `could not find the "missing" provider`},
+		{"bad", `provider "bad" has a non string extends value`},
+		{"undeclared", `could not find the "undeclared" provider`},
+	}
+	for _, tt := range tests {
+		_, err := resolveProviderBlock(providers, tt.name, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("resolveProviderBlock(%q) error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestInjectAccess(t *testing.T) {
+	access := mustBlocks(t, `
+shared:
+  scaleway:
+    key_id: shared-key
+    organisation: shared-org
+`)
+
+	block := mustBlocks(t, `
+p:
+  access: shared
+  scaleway:
+    zone: fr-par-1
+    access:
+      organisation: own-org
+`)["p"]
+	if err := injectAccess(block, access, "shared"); err != nil {
+		t.Fatal(err)
+	}
+	got := block["scaleway"].(rawBlock)["access"]
+	want := rawBlock{"key_id": "shared-key", "organisation": "own-org"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("injected access = %#v, want %#v", got, want)
+	}
+
+	if err := injectAccess(block, access, "missing"); err == nil || !strings.Contains(err.Error(), `could not find the "missing" access`) {
+		t.Errorf("injectAccess() with unknown access error = %v", err)
+	}
+	gcpBlock := mustBlocks(t, "p:\n  gcp:\n    zone: europe-west1-b\n")["p"]
+	if err := injectAccess(gcpBlock, access, "shared"); err == nil || !strings.Contains(err.Error(), "has no gcp credentials") {
+		t.Errorf("injectAccess() without provider credentials error = %v", err)
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	block := mustBlocks(t, `
+p:
+  extends: base
+  scaleway:
+    zone: fr-par-1
+    instance-type: DEV1-S
+    tags: [a, b]
+`)["p"]
+	applyOverrides(block, rawBlock{"instance-type": "GP1-M", "tags": []interface{}{"c"}})
+
+	got := block["scaleway"].(rawBlock)
+	if got["instance-type"] != "GP1-M" || got["zone"] != "fr-par-1" {
+		t.Errorf("overrides not applied over the base values: %#v", got)
+	}
+	if !reflect.DeepEqual(got["tags"], []interface{}{"c"}) {
+		t.Errorf("lists are replaced rather than merged, got %#v", got["tags"])
+	}
+	if block["extends"] != "base" {
+		t.Error("overrides must not be applied to the extends key")
+	}
+}
+
+const inheritConfig = `
+access:
+  shared:
+    scaleway:
+      key_id: shared-key
+      key_secret: shared-secret
+      organisation: shared-org
+providers:
+  base:
+    access: shared
+    scaleway:
+      zone: fr-par-1
+      image: ubuntu
+      instance-type: DEV1-S
+  large:
+    extends: base
+    scaleway:
+      instance-type: GP1-M
+runners:
+  small:
+    provider: base
+  large:
+    provider: large
+  large-ams:
+    provider: large
+    overrides:
+      zone: nl-ams-1
+`
+
+func TestParseOverridePrecedence(t *testing.T) {
+	c, err := parseTestConfig(inheritConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		runner       string
+		zone         string
+		instanceType string
+	}{
+		{"small", "fr-par-1", "DEV1-S"},
+		{"large", "fr-par-1", "GP1-M"},
+		{"large-ams", "nl-ams-1", "GP1-M"},
+	}
+	for _, tt := range tests {
+		p := c.Runners[tt.runner].GetProvider().(*scaleway.RunnerConfig)
+		if *p.Zone != tt.zone || *p.InstanceType != tt.instanceType {
+			t.Errorf("runner %q got zone %q and instance type %q, want %q and %q",
+				tt.runner, *p.Zone, *p.InstanceType, tt.zone, tt.instanceType)
+		}
+		if p.Access == nil || *p.Access.KeyID != "shared-key" {
+			t.Errorf("runner %q did not get the shared access", tt.runner)
+		}
+	}
+
+	// overrides of one runner type must not leak into the other using the same provider
+	if c.Runners["large"].GetProvider() == c.Runners["large-ams"].GetProvider() {
+		t.Error("runner types share the provider object")
+	}
+}
+
+func TestParseRejectsUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		conf string
+	}{
+		{"override typo", strings.Replace(inheritConfig, "      zone: nl-ams-1", "      instance_type: GP1-L", 1)},
+		{"provider typo", strings.Replace(inheritConfig, "      instance-type: GP1-M", "      instance-typ: GP1-M", 1)},
+		{"access typo", strings.Replace(inheritConfig, "      key_id: shared-key", "      key-id: shared-key", 1)},
+		{"runner type typo", strings.Replace(inheritConfig, "    provider: large\n    overrides:", "    provider: large\n    max-job-duraton: 1h\n    overrides:", 1)},
+		{"overrides typo", strings.Replace(inheritConfig, "    overrides:", "    overides:", 1)},
+		{"top level typo", strings.Replace(inheritConfig, "runners:", "unmatched-job:\n  ignore: true\nrunners:", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseTestConfig(tt.conf); err == nil || !strings.Contains(err.Error(), "not found in type") {
+				t.Errorf("parse error = %v, want the unknown field error", err)
+			}
+		})
+	}
+}
+
+func TestParseValidatesScalewayNetwork(t *testing.T) {
+	withOverrides := func(overrides string) string {
+		return strings.Replace(inheritConfig, "      zone: nl-ams-1", "      zone: nl-ams-1\n"+overrides, 1)
+	}
+	tests := []struct {
+		name    string
+		conf    string
+		wantErr string
+	}{
+		{"no public IP without private network", withOverrides("      public-ip: none"), "needs the private network"},
+		{"unknown public IP mode", withOverrides("      public-ip: ipv5"), "unknown public IP mode"},
+		{"no public IP with private network", withOverrides("      public-ip: none\n      private-network: pn-1"), ""},
+		{"ipv6 without private network", withOverrides("      public-ip: ipv6"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTestConfig(tt.conf)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("parse unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("parse error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseValidatesScalewayAccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    string
+		wantErr string
+	}{
+		{"organisation", inheritConfig, ""},
+		{"project only", strings.Replace(inheritConfig, "organisation: shared-org", "project: shared-project", 1), ""},
+		{"no organisation or project", strings.Replace(inheritConfig, "      organisation: shared-org\n", "", 1), "one of organisation or project must be set"},
+		{"no key secret", strings.Replace(inheritConfig, "      key_secret: shared-secret\n", "", 1), "key_secret must be set"},
+		{"no access", strings.Replace(inheritConfig, "    access: shared\n", "", 1), "has no access"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTestConfig(tt.conf)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("parse unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("parse error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
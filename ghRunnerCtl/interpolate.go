@@ -0,0 +1,85 @@
+package ghRunnerCtl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ${ENV_VAR}
+	envReference = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+	// ${{ secrets.NAME }} or ${{ env.NAME }}, resolved from the environment the same way
+	// GitHub Actions expects them to be mapped in with the step env
+	actionsReference = regexp.MustCompile(`^\$\{\{\s*(?:secrets|env)\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}$`)
+)
+
+const fileReferencePrefix = "file://"
+
+// interpolate walks the decoded yaml tree and resolves the references in the string values,
+// only values that are a reference as a whole are resolved, so cloud-init scripts using
+// shell variables are left untouched
+func interpolate(node interface{}, baseDir string) (interface{}, error) {
+	switch n := node.(type) {
+	case map[interface{}]interface{}:
+		for k, v := range n {
+			resolved, err := interpolate(v, baseDir)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", k, err)
+			}
+			n[k] = resolved
+		}
+		return n, nil
+	case []interface{}:
+		for i, v := range n {
+			resolved, err := interpolate(v, baseDir)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			n[i] = resolved
+		}
+		return n, nil
+	case string:
+		return resolveReference(n, baseDir)
+	default:
+		return node, nil
+	}
+}
+
+// resolveReference returns the value the reference points to, or the value itself if it
+// is not a reference, relative file paths are resolved against the baseDir
+func resolveReference(value string, baseDir string) (string, error) {
+	v := strings.TrimSpace(value)
+
+	if m := envReference.FindStringSubmatch(v); m != nil {
+		return lookupEnv(m[1])
+	}
+	if m := actionsReference.FindStringSubmatch(v); m != nil {
+		return lookupEnv(m[1])
+	}
+	if strings.HasPrefix(v, fileReferencePrefix) {
+		path := strings.TrimPrefix(v, fileReferencePrefix)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read referenced file %q: %w", path, err)
+		}
+		// files usually end with a newline which is never part of the key or token
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+
+	return value, nil
+}
+
+func lookupEnv(name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("referenced environment variable %q is not set", name)
+	}
+	return v, nil
+}
@@ -0,0 +1,112 @@
+package ghRunnerCtl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func setEnv(t *testing.T, key, value string) {
+	t.Helper()
+	prev, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestResolveReference(t *testing.T) {
+	setEnv(t, "RUNNER_CLI_TEST_TOKEN", "env-token")
+	os.Unsetenv("RUNNER_CLI_TEST_MISSING")
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "key.pem"), []byte("file-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr string
+	}{
+		{name: "plain value", value: "n1-standard-1", want: "n1-standard-1"},
+		{name: "env", value: "${RUNNER_CLI_TEST_TOKEN}", want: "env-token"},
+		{name: "env with spaces around", value: "  ${RUNNER_CLI_TEST_TOKEN} ", want: "env-token"},
+		{name: "actions secret", value: "${{ secrets.RUNNER_CLI_TEST_TOKEN }}", want: "env-token"},
+		{name: "actions env", value: "${{env.RUNNER_CLI_TEST_TOKEN}}", want: "env-token"},
+		{name: "relative file", value: "file://key.pem", want: "file-key"},
+		{name: "absolute file", value: "file://" + filepath.Join(dir, "key.pem"), want: "file-key"},
+		// only the whole value is a reference, shell variables in scripts are left alone
+		{name: "embedded reference", value: "echo ${RUNNER_CLI_TEST_TOKEN}", want: "echo ${RUNNER_CLI_TEST_TOKEN}"},
+		{name: "missing env", value: "${RUNNER_CLI_TEST_MISSING}", wantErr: `"RUNNER_CLI_TEST_MISSING" is not set`},
+		{name: "missing secret", value: "${{ secrets.RUNNER_CLI_TEST_MISSING }}", wantErr: `"RUNNER_CLI_TEST_MISSING" is not set`},
+		{name: "missing file", value: "file://missing.pem", wantErr: "could not read referenced file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveReference(tt.value, dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveReference(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveReference(%q) unexpected error: %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveReference(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateWalksTree(t *testing.T) {
+	setEnv(t, "RUNNER_CLI_TEST_KEY", "resolved")
+
+	tree := map[interface{}]interface{}{
+		"access": map[interface{}]interface{}{
+			"key": "${RUNNER_CLI_TEST_KEY}",
+		},
+		"tags":  []interface{}{"static", "${{ secrets.RUNNER_CLI_TEST_KEY }}"},
+		"count": 3,
+	}
+	got, err := interpolate(tree, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[interface{}]interface{}{
+		"access": map[interface{}]interface{}{
+			"key": "resolved",
+		},
+		"tags":  []interface{}{"static", "resolved"},
+		"count": 3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("interpolate() = %#v, want %#v", got, want)
+	}
+}
+
+func TestInterpolateErrorPath(t *testing.T) {
+	os.Unsetenv("RUNNER_CLI_TEST_MISSING")
+	tree := map[interface{}]interface{}{
+		"types": []interface{}{
+			map[interface{}]interface{}{"token": "${RUNNER_CLI_TEST_MISSING}"},
+		},
+	}
+	_, err := interpolate(tree, "")
+	if err == nil || !strings.HasPrefix(err.Error(), "types: [0]: token: ") {
+		t.Errorf("interpolate() error = %v, want the path to the value", err)
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"github.com/76creates/runner-cli/ghCtl"
 	"github.com/76creates/runner-cli/log"
 	"github.com/76creates/runner-cli/provider"
+	"github.com/google/go-github/v39/github"
 	"github.com/google/uuid"
+	"strings"
 	"time"
 )
 
@@ -15,6 +17,22 @@ import (
 type tendJob struct {
 	status string
 	maxRetry int
+	pollInterval time.Duration
+	pickupTimeout time.Duration
+	// maxJobDuration and maxInstanceLifetime are not enforced when zero
+	maxJobDuration time.Duration
+	maxInstanceLifetime time.Duration
+	// createdAt when the instance was created, instance lifetime is counted from it
+	createdAt time.Time
+	// preemptions how many times the instance was preempted before the job was picked up
+	preemptions int
+	// jobID of the workflow job the runner is created for
+	jobID int64
+
+	// jit registers the runner with the just-in-time config, labels and runnerGroupID are used for it
+	jit bool
+	labels []string
+	runnerGroupID int64
 }
 
 var (
@@ -22,29 +40,100 @@ var (
 	jobStatusRunning = "running"
 	jobStatusFailed = "failed"
 	jobStatusFinished= "finished"
+	jobStatusIgnored = "ignored"
 )
 
-func (j *tendJob) run(ctx context.Context, p provider.Provider, workflowRunID int64) error {
-	// name is the unique name given to GH runner and runner instance which we create here
-	// we append bit of randomness to the workflow id in order to support
-	// runners for multiple jobs within same workflow
-	name := fmt.Sprintf("runner-%d-%s", workflowRunID, uuid.NewString()[0:8])
+// newRunnerName returns the unique name given to GH runner and runner instance which we create,
+// we append bit of randomness to the workflow id in order to support runners for multiple jobs
+// within same workflow
+func newRunnerName(workflowRunID int64) string {
+	return fmt.Sprintf("runner-%d-%s", workflowRunID, uuid.NewString()[0:8])
+}
+
+// newJobInfo describes the workflow job for the provider
+func newJobInfo(client GithubClient, workflowRunID int64, job *github.WorkflowJob) provider.JobInfo {
+	return provider.JobInfo{
+		Repository:      client.Repository(),
+		ServerURL:       client.ServerURL(),
+		RegistrationURL: client.RegistrationURL(),
+		CABundle:        client.CABundle(),
+		WorkflowRunID: workflowRunID,
+		JobID:         job.GetID(),
+		JobName:       job.GetName(),
+	}
+}
+
+// run creates the runner and waits for it to serve the job, teardownCtx is used to remove the runner and
+// the instance so they are cleaned up even when ctx is cancelled
+func (j *tendJob) run(ctx, teardownCtx context.Context, client GithubClient, p provider.Provider, workflowRunID int64) error {
+	name := newRunnerName(workflowRunID)
 	log.DebugF("[%s] running the job", name)
 
 	j.status = jobStatusRunning
 
-	// creating a runner
+	for {
+		// instance lifetime is counted from the create request, so neither a slow create nor a runner
+		// that never comes online can keep the instance around past the max-instance-lifetime
+		j.createdAt = time.Now()
+		lifetimeCtx, cancel := j.lifetimeContext(ctx)
+
+		if err := j.createInstance(lifetimeCtx, client, p, name); err != nil {
+			cancel()
+			err = j.lifetimeErr(ctx, lifetimeCtx, err)
+			// instance might have been created before the failure, or the cancellation
+			if teardownErr := j.teardown(teardownCtx, client, p, name); teardownErr != nil {
+				log.ErrorF("[%s] %s", name, teardownErr.Error())
+			}
+			p.ReleaseGithubCredentials()
+			j.status = jobStatusFailed
+			return err
+		}
+
+		// runner registration and the instance are removed no matter how the job went
+		err := j.waitForJob(lifetimeCtx, client, p, name)
+		cancel()
+		err = j.lifetimeErr(ctx, lifetimeCtx, err)
+		if err != nil {
+			log.ErrorF("[%s] %s", name, err.Error())
+		}
+		teardownErr := j.teardown(teardownCtx, client, p, name)
+		// credentials are minted per runner, they are of no use once it is gone
+		p.ReleaseGithubCredentials()
+		if teardownErr != nil {
+			j.status = jobStatusFailed
+			return teardownErr
+		}
+
+		// job is still queued, runner is re-provisioned on the fresh instance
+		if _, ok := err.(*provider.InstancePreempted); ok && j.reprovision(p) {
+			name = newRunnerName(workflowRunID)
+			log.WarningF("[%s] re-provisioning the runner for the job %d after the preemption", name, j.jobID)
+			continue
+		}
+		if err != nil {
+			j.status = jobStatusFailed
+			return err
+		}
+		break
+	}
+
+	log.DebugF("[%s] finished successfully", name)
+	j.status = jobStatusFinished
+	return nil
+}
+
+// createInstance registers the runner and creates the instance, retrying up to the maxRetry times
+func (j *tendJob) createInstance(ctx context.Context, client GithubClient, p provider.Provider, name string) error {
 	log.DebugF("[%s] creating the runner", name)
-	done := false
 	for try := 0; try < j.maxRetry; try++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if p.WantGithubRegistrationToken() {
-			// generate github runner registration token
-			token, err := ghCtl.GenerateRunnerToken(ctx)
-			if err != nil {
+			if err := j.register(ctx, client, p, name); err != nil {
 				log.Error(err.Error())
 				return err
 			}
-			p.WithGithubRegistrationToken(token)
 		}
 
 		err := p.CreateInstance(ctx, name)
@@ -57,40 +146,219 @@ func (j *tendJob) run(ctx context.Context, p provider.Provider, workflowRunID in
 
 		// TODO: create a logging child function to integrate job name into all lines ran by it
 		log.DebugF("[%s] created instance successfully", name)
-		done = true
-		break
+		return nil
 	}
-	if ! done {
-		j.status = jobStatusFailed
-		return errors.New("failed completing the job")
+
+	return errors.New("failed completing the job")
+}
+
+// reprovision tells if the runner should be re-created after the preemption, provider is switched
+// to the on-demand instances once the preemption limit is reached
+func (j *tendJob) reprovision(p provider.Provider) bool {
+	preemptible, ok := p.(provider.Preemptible)
+	if !ok {
+		return false
 	}
 
-	// waiting for runner to become active
-	if p.WantGithubRegistrationToken() {
-		log.DebugF("[%s] waiting for a runner to become active", name)
-		err := ghCtl.WaitForRunnerToBecomeActive(ctx, name)
+	j.preemptions++
+	if j.preemptions >= preemptible.PreemptionLimit() {
+		log.WarningF("job %d was preempted %d time(s), falling back to the on-demand instance", j.jobID, j.preemptions)
+		preemptible.WithOnDemand()
+	}
+	return true
+}
+
+// jobLabel returns the label unique to the workflow job, JIT configured runners get it
+// so the runner can be traced back to the job it was created for, the job does not request
+// it so it does not bind the runner to the job, reconcile handles the runner serving some other job
+func jobLabel(jobID int64) string {
+	return fmt.Sprintf("job-%d", jobID)
+}
+
+// register mints the registration token, or the JIT config if the runner type uses it
+func (j *tendJob) register(ctx context.Context, client GithubClient, p provider.Provider, name string) error {
+	if j.jit {
+		// runner from the previous attempt is registered already, JIT config needs the name to be free
+		if err := client.RemoveRunner(ctx, name); err != nil {
+			return err
+		}
+		jitConfig, err := client.GenerateRunnerJITConfig(ctx, name, j.jitLabels(), j.runnerGroupID)
 		if err != nil {
-			log.ErrorF("[%s] error while waiting for runner to become active: %s", err.Error() )
-			j.status = jobStatusFailed
 			return err
 		}
+		p.WithGithubJITConfig(jitConfig)
+		return nil
 	}
 
-	// waiting for runner to finish executing
-	if p.WantGithubRegistrationToken() {
-		log.DebugF("[%s] waiting for a runner to finish executing", name)
-		// TODO: allow for custom wait time
-		err := ghCtl.WaitForRunnerToBeDeRegistered(ctx, name, 20,time.Second*30)
+	// generate github runner registration token
+	token, err := client.GenerateRunnerToken(ctx)
+	if err != nil {
+		return err
+	}
+	p.WithGithubRegistrationToken(token)
+	return nil
+}
+
+// planRegister sets the placeholders in place of the credentials register would mint, it follows the same
+// path so the planned user data is the one tend would render, returns the registration method used
+func (j *tendJob) planRegister(p provider.Provider) string {
+	if j.jit {
+		p.WithGithubJITConfig(provider.PlanJITConfig)
+		return fmt.Sprintf("jit-config, labels %s", strings.Join(j.jitLabels(), ", "))
+	}
+	p.WithGithubRegistrationToken(provider.PlanRegistrationToken)
+	return "registration-token"
+}
+
+// jitLabels returns the labels the JIT configured runner registers with, the job label
+// only marks the job the runner was created for
+func (j *tendJob) jitLabels() []string {
+	return append(append([]string{}, j.labels...), jobLabel(j.jobID))
+}
+
+// waitForJob waits for the runner to become active, verifies that it picked up the job it was
+// created for and waits for that job to complete
+func (j *tendJob) waitForJob(ctx context.Context, client GithubClient, p provider.Provider, name string) error {
+	if !p.WantGithubRegistrationToken() {
+		return nil
+	}
+
+	log.DebugF("[%s] waiting for a runner to become active", name)
+	err := client.WaitForRunnerToBecomeActive(ctx, name)
+	if err != nil {
+		// runner never shows up if the instance was preempted while booting
+		if statusErr := p.InstanceStatus(ctx, name); statusErr != nil {
+			if _, ok := statusErr.(*provider.InstancePreempted); ok {
+				return statusErr
+			}
+		}
+		return fmt.Errorf("error while waiting for runner to become active: %w", err)
+	}
+
+	log.DebugF("[%s] waiting for a runner to pick up and complete the job %d", name, j.jobID)
+	verified := false
+	pickupDeadline := time.Now().Add(j.pickupTimeout)
+	for {
+		if err := j.checkInstanceLifetime(); err != nil {
+			return err
+		}
+
+		job, err := client.GetWorkflowJob(ctx, j.jobID)
 		if err != nil {
-			log.ErrorF("[%s] error while waiting for runner to de-register: %s", name, err.Error() )
-			j.status = jobStatusFailed
 			return err
 		}
+
+		runnerName := job.GetRunnerName()
+		if runnerName != "" && runnerName != name {
+			log.WarningF("[%s] %s", name, (&JobPickedUpByOtherRunner{jobID: j.jobID, runnerName: runnerName}).Error())
+			return j.reconcile(ctx, client, name)
+		}
+		if runnerName == name && !verified {
+			log.DebugF("[%s] runner picked up the job %d", name, j.jobID)
+			verified = true
+		}
+
+		if job.GetStatus() == "completed" {
+			if !verified {
+				log.WarningF("[%s] job %d completed without being picked up, conclusion: %s", name, j.jobID, job.GetConclusion())
+			}
+			return nil
+		}
+
+		// preempted runner is re-provisioned only while the job is queued, job that was running
+		// on it is failed by GitHub
+		if statusErr := p.InstanceStatus(ctx, name); statusErr != nil {
+			if _, ok := statusErr.(*provider.InstancePreempted); ok && verified {
+				return fmt.Errorf("instance was preempted while running the job %d: %w", j.jobID, statusErr)
+			}
+			if _, ok := statusErr.(*provider.InstancePreempted); ok {
+				return statusErr
+			}
+			log.WarningF("[%s] could not get the instance status: %s", name, statusErr.Error())
+		}
+
+		if verified {
+			startedAt := job.GetStartedAt().Time
+			if j.maxJobDuration > 0 && !startedAt.IsZero() && time.Since(startedAt) > j.maxJobDuration {
+				return &LimitExceeded{limit: "max-job-duration", duration: j.maxJobDuration, jobID: j.jobID}
+			}
+		} else if time.Now().After(pickupDeadline) {
+			return fmt.Errorf("job %d was not picked up within %s", j.jobID, j.pickupTimeout)
+		}
+
+		time.Sleep(j.pollInterval)
+	}
+}
+
+// lifetimeContext returns the context that expires once the instance outlives the max-instance-lifetime
+func (j *tendJob) lifetimeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if j.maxInstanceLifetime > 0 {
+		return context.WithDeadline(ctx, j.createdAt.Add(j.maxInstanceLifetime))
+	}
+	return context.WithCancel(ctx)
+}
+
+// lifetimeErr replaces the error caused by the lifetime context expiring with the LimitExceeded,
+// errors caused by the cancellation of the parent context are returned as they are
+func (j *tendJob) lifetimeErr(ctx, lifetimeCtx context.Context, err error) error {
+	if err != nil && ctx.Err() == nil && lifetimeCtx.Err() == context.DeadlineExceeded {
+		return &LimitExceeded{limit: "max-instance-lifetime", duration: j.maxInstanceLifetime, jobID: j.jobID}
+	}
+	return err
+}
+
+// checkInstanceLifetime returns an error if the instance outlived the max-instance-lifetime
+func (j *tendJob) checkInstanceLifetime() error {
+	if j.maxInstanceLifetime > 0 && time.Since(j.createdAt) > j.maxInstanceLifetime {
+		return &LimitExceeded{limit: "max-instance-lifetime", duration: j.maxInstanceLifetime, jobID: j.jobID}
+	}
+	return nil
+}
+
+// reconcile handles the runner whose job was picked up by some other runner, if our runner is busy
+// it is serving some other job with the matching labels so it is left to finish it, otherwise it
+// is not needed anymore and can be torn down right away
+func (j *tendJob) reconcile(ctx context.Context, client GithubClient, name string) error {
+	servingSince := time.Now()
+	for {
+		if err := j.checkInstanceLifetime(); err != nil {
+			return err
+		}
+
+		runner, err := client.GetRunner(ctx, name)
+		if err != nil {
+			if _, ok := err.(*ghCtl.RunnerNotFound); ok {
+				log.DebugF("[%s] runner served some other job and de-registered", name)
+				return nil
+			}
+			return err
+		}
+		if !runner.GetBusy() {
+			log.DebugF("[%s] runner is idle, it is not needed anymore", name)
+			return nil
+		}
+		if j.maxJobDuration > 0 && time.Since(servingSince) > j.maxJobDuration {
+			return &LimitExceeded{limit: "max-job-duration", duration: j.maxJobDuration}
+		}
+
+		log.DebugF("[%s] runner is serving some other job, waiting for it to finish", name)
+		time.Sleep(j.pollInterval)
+	}
+}
+
+// teardown removes the runner registration, so a runner that was not started as ephemeral can not
+// pick up another job, and destroys the instance right after
+func (j *tendJob) teardown(ctx context.Context, client GithubClient, p provider.Provider, name string) error {
+	if p.WantGithubRegistrationToken() {
+		log.DebugF("[%s] removing the runner registration", name)
+		if err := client.RemoveRunner(ctx, name); err != nil {
+			// instance is destroyed regardless, runner will show up as offline
+			log.WarningF("[%s] error while removing the runner registration: %s", name, err.Error())
+		}
 	}
 
 	// deleting a runner
 	log.DebugF("[%s] deleting the runner", name)
-	done = false
 	for try := 0; try < j.maxRetry; try++ {
 		err := p.DestroyInstance(ctx, name)
 		if err != nil {
@@ -102,15 +370,31 @@ func (j *tendJob) run(ctx context.Context, p provider.Provider, workflowRunID in
 
 		// TODO: create a logging child function to integrate job name into all lines ran by it
 		log.DebugF("[%s] deleted the instance successfully", name)
-		done = true
-		break
-	}
-	if ! done {
-		j.status = jobStatusFailed
-		return errors.New("failed completing the job")
+		return nil
 	}
 
-	log.DebugF("[%s] finished successfully", name)
-	j.status = jobStatusFinished
-	return nil
-}
\ No newline at end of file
+	return errors.New("failed deleting the instance")
+}
+
+type JobPickedUpByOtherRunner struct {
+	jobID int64
+	runnerName string
+}
+
+func (e *JobPickedUpByOtherRunner) Error() string {
+	return fmt.Sprintf("[ JobPickedUpByOtherRunner ] job %d was picked up by the runner %q", e.jobID, e.runnerName)
+}
+
+type LimitExceeded struct {
+	limit string
+	duration time.Duration
+	jobID int64
+}
+
+func (e *LimitExceeded) Error() string {
+	job := ""
+	if e.jobID != 0 {
+		job = fmt.Sprintf(" while serving the job %d", e.jobID)
+	}
+	return fmt.Sprintf("[ LimitExceeded ] runner exceeded the %s of %s%s, it was torn down", e.limit, e.duration, job)
+}
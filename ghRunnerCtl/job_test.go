@@ -0,0 +1,110 @@
+package ghRunnerCtl
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTendJobRun(t *testing.T) {
+	runnerConfig := &RunnerConfig{Runners: map[string]*RunnerType{
+		"linux":       {},
+		"linux-jit":   {Labels: []string{"linux", "jit"}, JITConfig: true},
+		"linux-short": {Labels: []string{"linux", "short"}, MaxInstanceLifetime: 20 * time.Millisecond},
+	}}
+	tend := &Tend{Config: Config{MaxRetry: 1, PollInterval: time.Millisecond, PickupTimeout: 20 * time.Millisecond}}
+
+	tests := []struct {
+		name   string
+		labels []string
+		setup  func(c *fakeGithubClient)
+		// wantErr substring of the error, job is expected to finish if empty
+		wantErr string
+		wantJIT bool
+	}{
+		{name: "picked up and completed", labels: []string{"self-hosted", "linux"}},
+		{name: "jit runner picked up and completed", labels: []string{"jit"}, wantJIT: true},
+		{
+			name:    "pickup timeout",
+			labels:  []string{"linux"},
+			setup:   func(c *fakeGithubClient) { c.noPickup = true },
+			wantErr: "was not picked up within",
+		},
+		{
+			name:    "runner never becomes active",
+			labels:  []string{"linux"},
+			setup:   func(c *fakeGithubClient) { c.activeErr = errors.New("timed out") },
+			wantErr: "error while waiting for runner to become active",
+		},
+		{
+			name:    "instance lifetime exceeded before the runner is active",
+			labels:  []string{"short"},
+			setup:   func(c *fakeGithubClient) { c.neverActive = true },
+			wantErr: "max-instance-lifetime",
+		},
+		{
+			name:   "picked up by other runner",
+			labels: []string{"linux"},
+			setup:  func(c *fakeGithubClient) { c.pickedUpBy = "runner-other" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeGithubClient(42, tt.labels...)
+			if tt.setup != nil {
+				tt.setup(client)
+			}
+
+			runnerTypeName, runner, err := runnerConfig.MatchRunnerType(client.job.Labels)
+			if err != nil {
+				t.Fatalf("MatchRunnerType() unexpected error: %v", err)
+			}
+			p := &fakeProvider{}
+			p.WithJob(newJobInfo(client, 1, client.job))
+			j := tend.newTendJob(client.job, runnerTypeName, runner)
+
+			err = j.run(context.Background(), context.Background(), client, p, 1)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("run() unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("run() error = %v, want %q", err, tt.wantErr)
+			}
+			wantStatus := jobStatusFinished
+			if tt.wantErr != "" {
+				wantStatus = jobStatusFailed
+			}
+			if j.status != wantStatus {
+				t.Errorf("job status = %q, want %q", j.status, wantStatus)
+			}
+
+			if len(p.created) != 1 {
+				t.Fatalf("created instances = %v, want one", p.created)
+			}
+			name := p.created[0]
+			if !reflect.DeepEqual(p.destroyed, []string{name}) {
+				t.Errorf("destroyed instances = %v, want [%s]", p.destroyed, name)
+			}
+			if n := len(client.removed); n == 0 || client.removed[n-1] != name {
+				t.Errorf("removed runners = %v, want %s removed on teardown", client.removed, name)
+			}
+			if p.GithubRegistrationToken != "" || p.GithubJITConfig != "" {
+				t.Error("credentials were not released after the teardown")
+			}
+
+			if tt.wantJIT {
+				if want := []string{"linux", "jit", "job-42"}; !reflect.DeepEqual(client.jit[name], want) {
+					t.Errorf("JIT config labels = %v, want %v", client.jit[name], want)
+				}
+				if client.tokens != 0 {
+					t.Error("JIT configured runner must not mint the registration token")
+				}
+			} else if client.tokens != 1 {
+				t.Errorf("registration tokens minted = %d, want 1", client.tokens)
+			}
+		})
+	}
+}
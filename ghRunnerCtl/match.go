@@ -0,0 +1,160 @@
+package ghRunnerCtl
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// labelSelfHosted is a label every self-hosted runner is registered with
+const labelSelfHosted = "self-hosted"
+
+const (
+	// UnmatchedPolicyIgnoreHosted ignores jobs that target GitHub hosted runners, fails on the rest
+	UnmatchedPolicyIgnoreHosted = "ignore-hosted"
+	// UnmatchedPolicyIgnore ignores every job no runner type matched
+	UnmatchedPolicyIgnore = "ignore"
+	// UnmatchedPolicyFail fails on every job no runner type matched
+	UnmatchedPolicyFail = "fail"
+)
+
+// hostedLabel matches the labels of the GitHub hosted runners e.g. ubuntu, ubuntu-latest, windows-2019, macos-11
+var hostedLabel = regexp.MustCompile(`^(ubuntu|windows|macos)(-|$)`)
+
+// UnmatchedJobs tells tend what to do with the jobs for which no runner type is matched
+type UnmatchedJobs struct {
+	// Policy one of ignore-hosted, ignore or fail, defaults to ignore-hosted
+	Policy string `mapstructure:"policy" yaml:"policy"`
+	// CancelRun cancels the workflow run when the job that is not ignored requests a runner type we
+	// dont provide, otherwise the run would wait in the queue until GitHub times it out
+	CancelRun bool `mapstructure:"cancel-run" yaml:"cancel-run"`
+}
+
+func (u *UnmatchedJobs) validate() error {
+	switch u.Policy {
+	case "":
+		u.Policy = UnmatchedPolicyIgnoreHosted
+	case UnmatchedPolicyIgnoreHosted, UnmatchedPolicyIgnore, UnmatchedPolicyFail:
+	default:
+		return fmt.Errorf("unknown unmatched jobs policy %q", u.Policy)
+	}
+	return nil
+}
+
+// Ignore tells if the unmatched job with the labels should be ignored as per policy
+func (u UnmatchedJobs) Ignore(jobLabels []string) bool {
+	switch u.Policy {
+	case UnmatchedPolicyIgnore:
+		return true
+	case UnmatchedPolicyFail:
+		return false
+	default:
+		return isHostedJob(jobLabels)
+	}
+}
+
+// isHostedJob tells if the job is meant for the GitHub hosted runners
+func isHostedJob(jobLabels []string) bool {
+	hosted := false
+	for _, l := range jobLabels {
+		l = strings.ToLower(l)
+		if l == labelSelfHosted {
+			return false
+		}
+		if hostedLabel.MatchString(l) {
+			hosted = true
+		}
+	}
+	return hosted
+}
+
+// runnerTypeMatch is a candidate runner type for a job, lower score is a better fit
+type runnerTypeMatch struct {
+	name       string
+	runnerType *RunnerType
+	score      int
+}
+
+// MatchRunnerType selects the runner type for the job labels, runner type is a candidate only if all the
+// job labels are within its label set, its required labels are requested and none of its forbidden
+// labels are, out of the candidates one with the least unrequested labels wins, ties are broken by name
+func (c *RunnerConfig) MatchRunnerType(jobLabels []string) (string, *RunnerType, error) {
+	requested := newLabelSet(jobLabels)
+
+	var matches []runnerTypeMatch
+	for name, rt := range c.Runners {
+		available := newLabelSet(rt.GetLabels(name))
+		available.add(labelSelfHosted)
+
+		if !available.containsAll(requested) {
+			continue
+		}
+		if !requested.containsAll(newLabelSet(rt.Required)) {
+			continue
+		}
+		if requested.containsAny(newLabelSet(rt.Forbidden)) {
+			continue
+		}
+
+		matches = append(matches, runnerTypeMatch{
+			name:       name,
+			runnerType: rt,
+			score:      len(available) - len(requested),
+		})
+	}
+
+	if len(matches) == 0 {
+		return "", nil, &NoRunnerTypeMatched{labels: jobLabels}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score < matches[j].score
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	return matches[0].name, matches[0].runnerType, nil
+}
+
+type NoRunnerTypeMatched struct {
+	labels []string
+}
+
+func (e *NoRunnerTypeMatched) Error() string {
+	return fmt.Sprintf("[ NoRunnerTypeMatched ] no runner type provides all of the labels %v", e.labels)
+}
+
+// labelSet holds the labels, labels are case insensitive same as on GitHub
+type labelSet map[string]struct{}
+
+func newLabelSet(labels []string) labelSet {
+	s := make(labelSet, len(labels))
+	for _, l := range labels {
+		s.add(l)
+	}
+	return s
+}
+
+func (s labelSet) add(label string) {
+	s[strings.ToLower(label)] = struct{}{}
+}
+
+func (s labelSet) containsAll(other labelSet) bool {
+	for l := range other {
+		if _, ok := s[l]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (s labelSet) containsAny(other labelSet) bool {
+	for l := range other {
+		if _, ok := s[l]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package ghRunnerCtl
+
+import (
+	"testing"
+)
+
+func TestMatchRunnerType(t *testing.T) {
+	c := &RunnerConfig{Runners: map[string]*RunnerType{
+		// runner type name is its only label
+		"linux":       {},
+		"linux-large": {Labels: []string{"linux", "large"}},
+		"linux-gpu": {
+			Labels:   []string{"linux", "large", "gpu"},
+			Required: []string{"gpu"},
+		},
+		"linux-arm": {
+			Labels:    []string{"linux", "arm64"},
+			Forbidden: []string{"x64"},
+		},
+		"linux-x64": {Labels: []string{"linux", "x64"}},
+		// ties with the linux-x64 on the linux label, loses on the name
+		"linux-amd": {Labels: []string{"linux", "amd"}},
+		"windows":   {Labels: []string{"Windows", "X64"}},
+	}}
+
+	tests := []struct {
+		name   string
+		labels []string
+		want   string
+	}{
+		{name: "runner type name as the label", labels: []string{"linux"}, want: "linux"},
+		{name: "implicit self-hosted label", labels: []string{"self-hosted", "linux"}, want: "linux"},
+		{name: "least unrequested labels wins", labels: []string{"linux", "large"}, want: "linux-large"},
+		{name: "required label is requested", labels: []string{"linux", "gpu"}, want: "linux-gpu"},
+		{name: "required label is missing", labels: []string{"large"}, want: "linux-large"},
+		{name: "forbidden label is requested", labels: []string{"linux", "x64"}, want: "linux-x64"},
+		{name: "forbidden label is not requested", labels: []string{"arm64"}, want: "linux-arm"},
+		{name: "tie broken by name", labels: []string{"self-hosted", "x64"}, want: "linux-x64"},
+		{name: "tie broken by name with shared label", labels: []string{"amd"}, want: "linux-amd"},
+		{name: "case insensitive job labels", labels: []string{"Self-Hosted", "LINUX", "Large"}, want: "linux-large"},
+		{name: "case insensitive runner labels", labels: []string{"windows", "x64"}, want: "windows"},
+		{name: "no runner type provides all labels", labels: []string{"linux", "macos"}},
+		{name: "only the self-hosted label", labels: []string{"self-hosted"}, want: "linux"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rt, err := c.MatchRunnerType(tt.labels)
+			if tt.want == "" {
+				if _, ok := err.(*NoRunnerTypeMatched); !ok {
+					t.Fatalf("MatchRunnerType(%v) = %q, %v, want NoRunnerTypeMatched", tt.labels, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MatchRunnerType(%v) unexpected error: %v", tt.labels, err)
+			}
+			if got != tt.want {
+				t.Errorf("MatchRunnerType(%v) = %q, want %q", tt.labels, got, tt.want)
+			}
+			if rt != c.Runners[tt.want] {
+				t.Errorf("MatchRunnerType(%v) returned the runner type of some other name", tt.labels)
+			}
+		})
+	}
+}
+
+func TestMatchRunnerTypeIsDeterministic(t *testing.T) {
+	c := &RunnerConfig{Runners: map[string]*RunnerType{
+		"b": {Labels: []string{"linux"}},
+		"c": {Labels: []string{"linux"}},
+		"a": {Labels: []string{"linux"}},
+	}}
+	// map iteration order is random, the result must not depend on it
+	for i := 0; i < 50; i++ {
+		got, _, err := c.MatchRunnerType([]string{"linux"})
+		if err != nil || got != "a" {
+			t.Fatalf("MatchRunnerType() = %q, %v on the try %d, want %q", got, err, i, "a")
+		}
+	}
+}
+
+func TestUnmatchedJobsIgnore(t *testing.T) {
+	tests := []struct {
+		policy string
+		labels []string
+		want   bool
+	}{
+		{UnmatchedPolicyIgnoreHosted, []string{"ubuntu-latest"}, true},
+		{UnmatchedPolicyIgnoreHosted, []string{"ubuntu"}, true},
+		{UnmatchedPolicyIgnoreHosted, []string{"Windows"}, true},
+		{UnmatchedPolicyIgnoreHosted, []string{"macos"}, true},
+		{UnmatchedPolicyIgnoreHosted, []string{"macos-11"}, true},
+		{UnmatchedPolicyIgnoreHosted, []string{"self-hosted", "ubuntu"}, false},
+		{UnmatchedPolicyIgnoreHosted, []string{"ubuntults"}, false},
+		{UnmatchedPolicyIgnoreHosted, []string{"gpu"}, false},
+		{UnmatchedPolicyIgnore, []string{"self-hosted", "gpu"}, true},
+		{UnmatchedPolicyFail, []string{"ubuntu-latest"}, false},
+	}
+	for _, tt := range tests {
+		u := UnmatchedJobs{Policy: tt.policy}
+		if got := u.Ignore(tt.labels); got != tt.want {
+			t.Errorf("Ignore(%v) with the %q policy = %v, want %v", tt.labels, tt.policy, got, tt.want)
+		}
+	}
+}
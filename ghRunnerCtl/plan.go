@@ -0,0 +1,86 @@
+package ghRunnerCtl
+
+import (
+	"fmt"
+	"github.com/76creates/runner-cli/log"
+	"github.com/76creates/runner-cli/secret"
+	"github.com/google/go-github/v39/github"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// plan prints what tend would do for the currently queued jobs of the workflow run, it does all
+// the GitHub reads but never mints a registration token nor calls the provider to create an instance
+func (t *Tend) plan(workflowRun *github.WorkflowRun, runnerConfig *RunnerConfig) error {
+	log.Debug("planning the queued jobs")
+
+	workflowJobs, err := t.client.GetQueuedWorkflowRunJobs(t.ctx, workflowRun)
+	if err != nil {
+		return err
+	}
+
+	out := new(strings.Builder)
+	fmt.Fprintf(out, "workflow run %d (%s), %d queued job(s)\n", workflowRun.GetID(), workflowRun.GetStatus(), workflowJobs.GetTotalCount())
+
+	for _, job := range workflowJobs.Jobs {
+		fmt.Fprintf(out, "\njob %q (id %d)\n", job.GetName(), job.GetID())
+		fmt.Fprintf(out, "  labels:      %s\n", strings.Join(job.Labels, ", "))
+
+		runnerTypeName, runner, err := runnerConfig.MatchRunnerType(job.Labels)
+		if err != nil {
+			action := "fail"
+			if runnerConfig.UnmatchedJobs.Ignore(job.Labels) {
+				action = "ignore"
+			} else if runnerConfig.UnmatchedJobs.CancelRun {
+				action = "fail and cancel the workflow run"
+			}
+			fmt.Fprintf(out, "  runner type: none, would %s: %s\n", action, err.Error())
+			continue
+		}
+
+		p := runner.GetProvider().Clone()
+		p.WithJob(newJobInfo(t.client, t.workflowRunID, job))
+		registration := "none"
+		if p.WantGithubRegistrationToken() {
+			registration = t.newTendJob(job, runnerTypeName, runner).planRegister(p)
+		}
+
+		name := newRunnerName(t.workflowRunID)
+		instancePlan, err := p.PlanInstance(t.ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed planning the job %q: %w", job.GetName(), err)
+		}
+
+		fmt.Fprintf(out, "  runner type: %s\n", runnerTypeName)
+		fmt.Fprintf(out, "  provider:    %s (%s)\n", runner.Provider, instancePlan.Provider)
+		fmt.Fprintf(out, "  instance:    %s\n", name)
+		fmt.Fprintf(out, "  register:    %s\n", registration)
+		writePlanSpec(out, instancePlan.Spec)
+		if instancePlan.UserData != nil {
+			fmt.Fprintf(out, "  user-data:\n")
+			for _, line := range strings.Split(*instancePlan.UserData, "\n") {
+				fmt.Fprintf(out, "    %s\n", line)
+			}
+		}
+	}
+
+	// plan might contain secrets from the config or interpolated into the user data
+	_, err = io.WriteString(os.Stdout, secret.Redact(out.String()))
+	return err
+}
+
+// writePlanSpec writes the instance spec sorted by the field name
+func writePlanSpec(out io.Writer, spec map[string]string) {
+	keys := make([]string, 0, len(spec))
+	for k := range spec {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(out, "  spec:\n")
+	for _, k := range keys {
+		fmt.Fprintf(out, "    %s: %s\n", k, spec[k])
+	}
+}
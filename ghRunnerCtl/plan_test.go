@@ -0,0 +1,50 @@
+package ghRunnerCtl
+
+import (
+	"testing"
+
+	"github.com/76creates/runner-cli/provider"
+	"github.com/76creates/runner-cli/provider/scaleway"
+	"github.com/76creates/runner-cli/secret"
+)
+
+func TestPlanRegister(t *testing.T) {
+	tests := []struct {
+		name      string
+		job       *tendJob
+		wantToken string
+		wantJIT   string
+		want      string
+	}{
+		{
+			name:      "registration token",
+			job:       &tendJob{labels: []string{"linux"}},
+			wantToken: provider.PlanRegistrationToken,
+			want:      "registration-token",
+		},
+		{
+			name:    "jit config",
+			job:     &tendJob{jit: true, jobID: 42, labels: []string{"linux", "large"}},
+			wantJIT: provider.PlanJITConfig,
+			want:    "jit-config, labels linux, large, job-42",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := new(scaleway.RunnerConfig)
+			if got := tt.job.planRegister(p); got != tt.want {
+				t.Errorf("planRegister() = %q, want %q", got, tt.want)
+			}
+			if p.GithubRegistrationToken != tt.wantToken || p.GithubJITConfig != tt.wantJIT {
+				t.Errorf("planRegister() set token %q and JIT config %q", p.GithubRegistrationToken, p.GithubJITConfig)
+			}
+		})
+	}
+
+	// placeholders are shown in the plan as they are
+	for _, placeholder := range []string{provider.PlanRegistrationToken, provider.PlanJITConfig} {
+		if got := secret.Redact(placeholder); got != placeholder {
+			t.Errorf("plan placeholder %q is redacted", placeholder)
+		}
+	}
+}
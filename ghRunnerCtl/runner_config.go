@@ -7,34 +7,82 @@ import (
 	"github.com/76creates/runner-cli/provider/scaleway"
 	"gopkg.in/yaml.v2"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 
-// TODO: this should be a file where there is a list of possible "access" objects, and we should inject them if not overriden per type itself
-
 // TODO: dont use viper get, use these objects to run "CREATE" or "DELETE" and such
 
 // RunnerProvider holds the runner configuration per provider, configs should be declared in the providers namespace
 type RunnerProvider struct {
+	// Extends name of the provider block whose values are used as defaults for this one
+	Extends string `mapstructure:"extends,omitempty" yaml:"extends,omitempty"`
+	// Access name of the shared access block declared in the access object
+	Access string `mapstructure:"access,omitempty" yaml:"access,omitempty"`
+
 	Scaleway *scaleway.RunnerConfig `mapstructure:"scaleway,omitempty" yaml:"scaleway"`
 	GCP *gcp.RunnerConfig `mapstructure:"gcp,omitempty" yaml:"gcp"`
 }
 
+// AccessProvider holds the credentials per provider, it is declared once in the access namespace
+// and referenced by name from the providers or runners
+type AccessProvider struct {
+	Scaleway *scaleway.AccessConfig `mapstructure:"scaleway,omitempty" yaml:"scaleway"`
+	GCP *gcp.AccessConfig `mapstructure:"gcp,omitempty" yaml:"gcp"`
+}
+
 type RunnerType struct {
 	// Provider name of the provider declared in the providers object
 	Provider string `mapstructure:"provider" yaml:"provider"`
+	// Access name of the shared access block, overrides the one set on the provider
+	Access string `mapstructure:"access,omitempty" yaml:"access,omitempty"`
+	// Overrides provider fields, such as instance type or image, for this runner type only
+	Overrides rawBlock `mapstructure:"overrides,omitempty" yaml:"overrides,omitempty"`
+	// Labels full set of labels the runner provides, defaults to the runner type name
+	Labels []string `mapstructure:"labels,omitempty" yaml:"labels,omitempty"`
+	// Required labels job must request for this runner type to be selected
+	Required []string `mapstructure:"required-labels,omitempty" yaml:"required-labels,omitempty"`
+	// Forbidden labels job must not request for this runner type to be selected
+	Forbidden []string `mapstructure:"forbidden-labels,omitempty" yaml:"forbidden-labels,omitempty"`
+	// RunnerGroup the runner joins when registering, default group is used if empty
+	RunnerGroup string `mapstructure:"runner-group,omitempty" yaml:"runner-group,omitempty"`
+	// Ephemeral registers the runner for a single job only, defaults to true
+	Ephemeral *bool `mapstructure:"ephemeral,omitempty" yaml:"ephemeral,omitempty"`
+	// JITConfig registers the runner with the just-in-time config instead of the registration token,
+	// runner runs one job and exits, GitHub may hand it any queued job its labels match
+	JITConfig bool `mapstructure:"jit-config,omitempty" yaml:"jit-config,omitempty"`
+	// RunnerGroupID the JIT configured runner joins, default group(1) is used if empty
+	RunnerGroupID int64 `mapstructure:"runner-group-id,omitempty" yaml:"runner-group-id,omitempty"`
+	// MaxJobDuration how long the job may run for once picked up, runner is torn down when exceeded,
+	// no limit if empty
+	MaxJobDuration time.Duration `mapstructure:"max-job-duration,omitempty" yaml:"max-job-duration,omitempty"`
+	// MaxInstanceLifetime how long the instance may exist for, counted from its creation, runner is
+	// torn down when exceeded, no limit if empty
+	MaxInstanceLifetime time.Duration `mapstructure:"max-instance-lifetime,omitempty" yaml:"max-instance-lifetime,omitempty"`
+	// Vars user defined variables passed to the cloud-init templates as .Vars
+	Vars map[string]string `mapstructure:"vars,omitempty" yaml:"vars,omitempty"`
 
 	provider provider.Provider
 }
 
 type ConfigYaml struct{
+	UnmatchedJobs UnmatchedJobs `mapstructure:"unmatched-jobs" yaml:"unmatched-jobs"`
 	Types map[string]RunnerType `mapstructure:"runners" yaml:"runners"`
-	Providers map[string]RunnerProvider `mapstructure:"providers" yaml:"providers"`
+	// Providers are kept raw so the extends and overrides can be resolved before decoding
+	Providers map[string]rawBlock `mapstructure:"providers" yaml:"providers"`
+	Access map[string]rawBlock `mapstructure:"access" yaml:"access"`
+
+	// baseDir is the directory relative paths within the config are resolved against
+	baseDir string
 }
 
 type RunnerConfig struct {
 	Runners map[string]*RunnerType
+	UnmatchedJobs UnmatchedJobs
 }
 
 func (rt RunnerType)GetProvider() (p provider.Provider) {
@@ -42,65 +90,219 @@ func (rt RunnerType)GetProvider() (p provider.Provider) {
 	return p
 }
 
+// IsEphemeral tells if the runner should be registered for a single job only
+func (rt RunnerType)IsEphemeral() bool {
+	return rt.Ephemeral == nil || *rt.Ephemeral
+}
+
+// GetRunnerGroupID returns the runner group id used for the JIT config
+func (rt RunnerType)GetRunnerGroupID() int64 {
+	if rt.RunnerGroupID == 0 {
+		return 1
+	}
+	return rt.RunnerGroupID
+}
+
+// GetLabels returns the labels runner type provides, if none are declared the runner type name is used
+func (rt RunnerType)GetLabels(name string) []string {
+	if len(rt.Labels) == 0 {
+		return []string{name}
+	}
+	return rt.Labels
+}
+
 // Parse the yaml runner config file into the object, panics if config cannot be decoded
+// values in the form of ${ENV_VAR}, ${{ secrets.NAME }} and file://path are resolved,
+// relative paths are resolved against the working directory
 func Parse(file io.Reader) *RunnerConfig {
+	return parse(file, ".")
+}
+
+// ParseFile the yaml runner config file at the path into the object, panics if config cannot be
+// read or decoded, relative paths within the config are resolved against the config directory
+func ParseFile(path string) *RunnerConfig {
+	file, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	return parse(file, filepath.Dir(path))
+}
+
+func parse(file io.Reader, baseDir string) *RunnerConfig {
 	c := new(RunnerConfig)
 	c.Runners = make(map[string]*RunnerType)
 
-	runnerConf := new(ConfigYaml)
-	err := yaml.NewDecoder(file).Decode(&runnerConf)
+	runnerConf, err := decodeConfig(file, baseDir)
 	if err != nil {
 		panic(err)
 	}
 
-	mp := getProviderMap(runnerConf.Providers)
+	if len(runnerConf.Providers) == 0 {
+		panic("no provider defined")
+	}
+	if err = runnerConf.UnmatchedJobs.validate(); err != nil {
+		panic(err)
+	}
+	c.UnmatchedJobs = runnerConf.UnmatchedJobs
+	if err = validateAccess(runnerConf.Access); err != nil {
+		panic(err)
+	}
+	// every provider block is validated, even if no runner type is using it
+	for providerName := range runnerConf.Providers {
+		if _, err = runnerConf.resolveProvider(providerName, RunnerType{}); err != nil {
+			panic(err)
+		}
+	}
 
 	for k, v := range runnerConf.Types {
-		if _, ok := mp[v.Provider]; !ok {
-			panic(fmt.Sprintf("could not find the %q provider in the providers object", v.Provider))
+		// each runner type gets its own provider object so overrides do not leak between them
+		p, err := runnerConf.resolveProvider(v.Provider, v)
+		if err != nil {
+			panic(fmt.Sprintf("runner %q: %s", k, err.Error()))
 		}
+		if l, ok := p.(provider.CloudInitLoader); ok {
+			if err = l.LoadCloudInit(runnerConf.baseDir); err != nil {
+				panic(fmt.Sprintf("runner %q: %s", k, err.Error()))
+			}
+		}
+
+		p.WithRunnerType(k)
+		p.WithRunnerSpec(provider.RunnerSpec{
+			Labels:    v.GetLabels(k),
+			Group:     v.RunnerGroup,
+			Ephemeral: v.IsEphemeral(),
+			Vars:      v.Vars,
+		})
 
-		c.Runners[k] = &RunnerType{provider: mp[v.Provider]}
+		rt := v
+		rt.provider = p
+		c.Runners[k] = &rt
 	}
 
 	return c
 }
 
-// ParseString the yaml runner config string into the object, panics if config cannot be decoded
-func ParseString(conf string) *RunnerConfig {
-	return Parse(strings.NewReader(conf))
-}
+// resolveProvider builds the provider for the runner type, it applies the extends chain, injects the
+// shared access block and finally applies the runner type overrides
+func (conf *ConfigYaml) resolveProvider(providerName string, rt RunnerType) (provider.Provider, error) {
+	block, err := resolveProviderBlock(conf.Providers, providerName, nil)
+	if err != nil {
+		return nil, err
+	}
 
-// getProvider attempts to extract the provider from the RunnerProvider, on failure it panics
-// if it finds two providers under same config it will panic
-func getProviderMap(in map[string]RunnerProvider) map[string]provider.Provider {
-	if len(in) == 0 {
-		panic("no provider defined")
+	accessName, _ := block[keyAccess].(string)
+	if rt.Access != "" {
+		accessName = rt.Access
+	}
+	if accessName != "" {
+		if err = injectAccess(block, conf.Access, accessName); err != nil {
+			return nil, err
+		}
 	}
+	delete(block, keyAccess)
 
-	mp := make(map[string]provider.Provider)
+	applyOverrides(block, rt.Overrides)
 
-	for providerName, providerMap := range in {
-		// this needs to be repeated for every provider that will be added in the future as is atm
-		if providerMap.Scaleway != nil {
-			if _, ok := mp[providerName]; ok {
-				panic(fmt.Sprintf("more than one provider for name %s", providerName))
-			}
-			mp[providerName] = providerMap.Scaleway
+	rp := new(RunnerProvider)
+	if err = decodeBlock(block, rp); err != nil {
+		return nil, fmt.Errorf("could not decode the %q provider: %w", providerName, err)
+	}
+
+	return getProvider(providerName, rp)
+}
+
+// validateAccess decodes the shared access blocks to make sure they are well formed
+func validateAccess(access map[string]rawBlock) error {
+	for name, block := range access {
+		ap := new(AccessProvider)
+		if err := decodeBlock(block, ap); err != nil {
+			return fmt.Errorf("could not decode the %q access: %w", name, err)
 		}
-		if providerMap.GCP != nil {
-			if _, ok := mp[providerName]; ok {
-				panic(fmt.Sprintf("more than one provider for name %s", providerName))
+		if ap.Scaleway != nil {
+			if err := ap.Scaleway.Validate(); err != nil {
+				return fmt.Errorf("invalid %q access: %w", name, err)
 			}
-			mp[providerName] = providerMap.GCP
 		}
-		// panic if no provider has been matched
-		if _, ok := mp[providerName]; !ok {
-			panic(fmt.Sprintf("no provider matched for name %s", providerName))
+		if ap.GCP != nil {
+			if err := ap.GCP.Validate(); err != nil {
+				return fmt.Errorf("invalid %q access: %w", name, err)
+			}
 		}
 	}
+	return nil
+}
+
+// decodeConfig reads the config, resolves references in it and decodes it into the ConfigYaml
+func decodeConfig(file io.Reader, baseDir string) (*ConfigYaml, error) {
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw interface{}
+	if err = yaml.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	raw, err = interpolate(raw, baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve config references: %w", err)
+	}
+
+	// encode resolved tree back so we can decode it into the typed config
+	content, err = yaml.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// unknown keys are rejected so a typo in a runner type is not silently ignored
+	runnerConf := &ConfigYaml{baseDir: baseDir}
+	if err = yaml.UnmarshalStrict(content, runnerConf); err != nil {
+		return nil, err
+	}
+
+	return runnerConf, nil
+}
 
-	return mp
+// ParseString the yaml runner config string into the object, panics if config cannot be decoded
+func ParseString(conf string) *RunnerConfig {
+	return Parse(strings.NewReader(conf))
 }
 
+// getProvider attempts to extract the provider from the RunnerProvider, errors if there is no provider
+// or if it finds two providers under same config
+func getProvider(providerName string, providerMap *RunnerProvider) (provider.Provider, error) {
+	var p provider.Provider
 
+	// this needs to be repeated for every provider that will be added in the future as is atm
+	if providerMap.Scaleway != nil {
+		if providerMap.Scaleway.Access == nil {
+			return nil, fmt.Errorf("scaleway provider %s has no access", providerName)
+		}
+		if err := providerMap.Scaleway.Access.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid scaleway access for the provider %s: %w", providerName, err)
+		}
+		if err := providerMap.Scaleway.ValidateNetwork(); err != nil {
+			return nil, fmt.Errorf("invalid scaleway network for the provider %s: %w", providerName, err)
+		}
+		p = providerMap.Scaleway
+	}
+	if providerMap.GCP != nil {
+		if p != nil {
+			return nil, fmt.Errorf("more than one provider for name %s", providerName)
+		}
+		if providerMap.GCP.Access != nil {
+			if err := providerMap.GCP.Access.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid gcp access for the provider %s: %w", providerName, err)
+			}
+		}
+		p = providerMap.GCP
+	}
+	// error if no provider has been matched
+	if p == nil {
+		return nil, fmt.Errorf("no provider matched for name %s", providerName)
+	}
+
+	return p, nil
+}
@@ -3,51 +3,103 @@ package ghRunnerCtl
 import (
 	"context"
 	"fmt"
-	"github.com/76creates/runner-cli/ghCtl"
 	"github.com/76creates/runner-cli/log"
 	"github.com/google/go-github/v39/github"
+	"sync"
 	"time"
 )
 
+// Config holds the tend settings, it is decoded from the tend namespace of the config
+type Config struct {
+	// PollInterval between the workflow run checks
+	PollInterval time.Duration `mapstructure:"poll-interval"`
+	// MaxRetry how many times the instance creation and deletion is attempted
+	MaxRetry int `mapstructure:"max-retry"`
+	// PickupTimeout how long to wait for the job to be picked up once the runner is active,
+	// time the job runs for is limited with the max-job-duration of the runner type
+	PickupTimeout time.Duration `mapstructure:"pickup-timeout"`
+}
+
+// Validate fills in the defaults
+func (c *Config) Validate() error {
+	if c.PollInterval == 0 {
+		c.PollInterval = time.Second * 20
+	}
+	if c.MaxRetry == 0 {
+		c.MaxRetry = 2
+	}
+	if c.PickupTimeout == 0 {
+		c.PickupTimeout = time.Minute * 10
+	}
+	if c.PollInterval < 0 || c.MaxRetry < 0 || c.PickupTimeout < 0 {
+		return fmt.Errorf("tend intervals, timeouts and retries must be positive")
+	}
+	return nil
+}
+
 type Tend struct {
+	// DryRun only prints what would be done for the queued jobs, no runner is created
+	DryRun bool
+	Config Config
+
 	ctx context.Context
+	client GithubClient
 	workflowRunID int64
 }
 
-// Start detects jobs that are in need of handling and spawns a dedicated coroutine
-func (t *Tend)Start(ctx context.Context, workflowRunID int64, runnerConfig *RunnerConfig) error {
+// Start detects jobs that are in need of handling and spawns a dedicated coroutine, it returns only
+// once all the job coroutines have exited so the provider clients can be closed right after
+func (t *Tend)Start(ctx context.Context, client GithubClient, workflowRunID int64, runnerConfig *RunnerConfig) error {
 	t.ctx = ctx
+	t.client = client
 	t.workflowRunID = workflowRunID
+	if err := t.Config.Validate(); err != nil {
+		return err
+	}
 
 	jobs := make(map[string]*tendJob)
-	// init gh client
-	t.ctx = context.WithValue(ctx, "client", ghCtl.InitClient(t.ctx))
 
 	// validate that the workflow exists
-	workflowRun, err := ghCtl.GetWorkflowRunWithTheID(t.ctx, t.workflowRunID)
+	workflowRun, err := t.client.GetWorkflowRunWithTheID(t.ctx, t.workflowRunID)
 	if err != nil {
 		return err
 	}
 
+	if t.DryRun {
+		return t.plan(workflowRun, runnerConfig)
+	}
+
+	// jobs run with their own context, when tend has to exit early it is cancelled and the in-flight
+	// jobs are waited on so their instances and runner registrations are torn down before returning
+	jobsCtx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	abort := func(err error) error {
+		log.Warning("cancelling the in-flight jobs")
+		cancel()
+		wg.Wait()
+		return err
+	}
+
 	// run as long as workflow run is not completed
 	// TODO: move this to coroutine
 	for !workflowRunIsComplete(workflowRun) {
 		// update workflow run
-		workflowRun, err = ghCtl.GetWorkflowRunWithTheID(t.ctx, workflowRunID)
+		workflowRun, err = t.client.GetWorkflowRunWithTheID(t.ctx, workflowRunID)
 		if err != nil {
-			return err
+			return abort(err)
 		}
 
-		workflowJobs, err := ghCtl.GetQueuedWorkflowRunJobs(t.ctx, workflowRun)
+		workflowJobs, err := t.client.GetQueuedWorkflowRunJobs(t.ctx, workflowRun)
 		if err != nil {
 			// TODO: implement retry function
 			log.Warning("failed getting workflow run jobs")
-			return err
+			return abort(err)
 		}
 		// log.DebugF("number of queued jobs: %d", workflowJobs.GetTotalCount())
 		// no workflow running at the moment
 		if workflowJobs.GetTotalCount() == 0 {
-			time.Sleep(time.Second * 20)
+			time.Sleep(t.Config.PollInterval)
 			continue
 		}
 
@@ -56,7 +108,7 @@ func (t *Tend)Start(ctx context.Context, workflowRunID int64, runnerConfig *Runn
 			jobName := fmt.Sprintf("%d-%s",workflowRunID, job.GetName())
 			if _, ok := jobs[jobName]; ok {
 				if jobs[jobName].status == jobStatusFailed {
-					return fmt.Errorf("job %q failed, exiting", jobName)
+					return abort(fmt.Errorf("job %q failed, exiting", jobName))
 				}
 
 				// TODO: handle other status codes here
@@ -65,44 +117,51 @@ func (t *Tend)Start(ctx context.Context, workflowRunID int64, runnerConfig *Runn
 				continue
 			}
 
-			// iter trough job labels and use first runner config that matches a label
+			// select runner type that provides all the labels job is asking for
 			// https://docs.github.com/en/rest/reference/actions#get-a-job-for-a-workflow-run
-			var runner *RunnerType
-			var label string
-			for _, l := range job.Labels {
-				if r, ok := runnerConfig.Runners[l]; ok {
-					runner = r
-					label = l
-					break
+			runnerTypeName, runner, err := runnerConfig.MatchRunnerType(job.Labels)
+			if err != nil {
+				if runnerConfig.UnmatchedJobs.Ignore(job.Labels) {
+					log.WarningF("ignoring the job name %q: %s", job.GetName(), err.Error())
+					jobs[jobName] = &tendJob{status: jobStatusIgnored}
+					continue
 				}
+
+				log.ErrorF("could not find runner type for the job name %q: %s", job.GetName(), err.Error())
+				if runnerConfig.UnmatchedJobs.CancelRun {
+					if cancelErr := t.client.CancelWorkflowRun(t.ctx, workflowRunID); cancelErr != nil {
+						log.ErrorF("failed cancelling the workflow run: %s", cancelErr.Error())
+					}
+				}
+				return abort(err)
 			}
-			if runner == nil {
-				// TODO: if its not like "ubuntu|windows|mac" exit with error
-				log.WarningF("could not find workflow config for the job name %q", job.GetName())
-			}
+			log.DebugF("job %q matched runner type %q", job.GetName(), runnerTypeName)
 
-			provider := runner.provider
-			provider.WithRunnerType(label)
+			// every job gets its own copy of the provider since job values are set on it
+			provider := runner.GetProvider().Clone()
+			provider.WithJob(newJobInfo(t.client, workflowRunID, job))
 
-			j := new(tendJob)
+			j := t.newTendJob(job, runnerTypeName, runner)
 			jobs[jobName] = j
-			j.status = jobStatusQueued
-			j.maxRetry = 2
 
-			// TODO: handle error
-			go j.run(t.ctx, provider, workflowRunID)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// error is reported through the job status
+				_ = j.run(jobsCtx, t.ctx, t.client, provider, workflowRunID)
+			}()
 		}
 
-		time.Sleep(time.Second * 20)
+		time.Sleep(t.Config.PollInterval)
 	}
 	log.Debug("waiting for all jobs to finish")
 allJobs:
 	for {
 		for name, job := range jobs {
-			if job.status != jobStatusFinished {
+			if job.status != jobStatusFinished && job.status != jobStatusIgnored {
 				if job.status == jobStatusFailed {
 					// TODO: should we "log" error that job produced and print it here?
-					return fmt.Errorf("job %q failed", name)
+					return abort(fmt.Errorf("job %q failed", name))
 				}
 				log.DebugF("job %q not finished, current status: %s", name, job.status)
 				time.Sleep(time.Second * 10)
@@ -111,11 +170,29 @@ allJobs:
 		}
 		break
 	}
+	// job sets its final status right before its coroutine exits
+	wg.Wait()
 
 	log.Debug("all done")
 	return nil
 }
 
+// newTendJob creates the queued job for the workflow job matched to the runner type
+func (t *Tend) newTendJob(job *github.WorkflowJob, runnerTypeName string, runner *RunnerType) *tendJob {
+	j := new(tendJob)
+	j.status = jobStatusQueued
+	j.maxRetry = t.Config.MaxRetry
+	j.pickupTimeout = t.Config.PickupTimeout
+	j.maxJobDuration = runner.MaxJobDuration
+	j.maxInstanceLifetime = runner.MaxInstanceLifetime
+	j.pollInterval = t.Config.PollInterval
+	j.jobID = job.GetID()
+	j.jit = runner.JITConfig
+	j.labels = runner.GetLabels(runnerTypeName)
+	j.runnerGroupID = runner.GetRunnerGroupID()
+	return j
+}
+
 func workflowRunIsComplete(workflowRun *github.WorkflowRun) bool {
 	return workflowRun.GetStatus() == "completed"
 }
\ No newline at end of file
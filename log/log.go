@@ -2,7 +2,7 @@ package log
 
 import (
 	"fmt"
-	"github.com/spf13/viper"
+	"github.com/76creates/runner-cli/secret"
 	"io"
 	"os"
 	"strings"
@@ -10,9 +10,33 @@ import (
 
 // TODO: child logger with additional string? zerolog maybe?
 
+const (
+	// FormatText colored messages meant for the terminal
+	FormatText = "text"
+	// FormatActions workflow commands so the messages are annotated within the GitHub Actions run
+	FormatActions = "actions"
+)
+
+// Config holds the log settings, it is decoded from the log namespace of the config
+type Config struct {
+	Debug bool `mapstructure:"debug"`
+	// Format one of text or actions
+	Format string `mapstructure:"format"`
+}
+
+var config = Config{Format: FormatText}
+
+// Configure sets the log settings used by all the subsequent messages
+func Configure(c Config) {
+	if c.Format == "" {
+		c.Format = FormatText
+	}
+	config = c
+}
+
 // Debug prints the message in a debug format
 func Debug(content string) {
-	if viper.GetBool("debug") {
+	if config.Debug {
 		log("debug", os.Stdout, content)
 	}
 }
@@ -43,8 +67,11 @@ func ErrorF(format string, a ...interface{}) {
 }
 
 func log(lvl string, out io.Writer, content string) {
+	// never let registered secrets reach the output
+	content = secret.Redact(content)
+
 	var msg string
-	if viper.GetBool("github.actions") {
+	if config.Format == FormatActions {
 		msg = fmt.Sprintf("::%s::%s", lvl, content)
 	} else {
 		var color string
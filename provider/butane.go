@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	butane "github.com/coreos/butane/config"
+	"github.com/coreos/butane/config/common"
+	ignition "github.com/coreos/ignition/v2/config"
+)
+
+// butaneToIgnition translates the Butane config into the Ignition JSON with the upstream translation, it is
+// strict so unknown keys and every other warning are errors, local files and trees are not supported
+// since there is no directory to embed them from
+func butaneToIgnition(config string) (*string, error) {
+	out, r, err := butane.TranslateBytes([]byte(config), common.TranslateBytesOptions{})
+	if err != nil {
+		if len(r.Entries) > 0 {
+			return nil, fmt.Errorf("invalid butane config: %w: %s", err, strings.TrimSpace(r.String()))
+		}
+		return nil, fmt.Errorf("invalid butane config: %w", err)
+	}
+	if len(r.Entries) > 0 {
+		return nil, fmt.Errorf("invalid butane config: %s", strings.TrimSpace(r.String()))
+	}
+
+	str := string(out)
+	return &str, nil
+}
+
+// validateIgnition parses the user data as the Ignition config of any supported spec version, it fails
+// on the unknown keys and invalid values same as Ignition would on the boot
+func validateIgnition(userData string) error {
+	_, r, err := ignition.Parse([]byte(userData))
+	if err != nil {
+		if len(r.Entries) > 0 {
+			return fmt.Errorf("invalid ignition config: %w: %s", err, strings.TrimSpace(r.String()))
+		}
+		return fmt.Errorf("invalid ignition config: %w", err)
+	}
+	if len(r.Entries) > 0 {
+		return fmt.Errorf("invalid ignition config: %s", strings.TrimSpace(r.String()))
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package provider
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestButaneToIgnition(t *testing.T) {
+	tests := []struct {
+		name    string
+		butane  string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "fcos inline file",
+			butane: `variant: fcos
+version: 1.4.0
+storage:
+  files:
+    - path: /etc/hello
+      mode: 0644
+      contents:
+        inline: hello world
+`,
+			want: `{"ignition":{"version":"3.3.0"},"storage":{"files":[{"path":"/etc/hello","contents":{"compression":"","source":"data:,hello%20world"},"mode":420}]}}`,
+		},
+		{
+			name: "fcos older version",
+			butane: `variant: fcos
+version: 1.1.0
+passwd:
+  users:
+    - name: core
+      ssh_authorized_keys:
+        - ssh-ed25519 AAAA
+`,
+			want: `{"ignition":{"version":"3.1.0"},"passwd":{"users":[{"name":"core","sshAuthorizedKeys":["ssh-ed25519 AAAA"]}]}}`,
+		},
+		{
+			name: "flatcar unit",
+			butane: `variant: flatcar
+version: 1.0.0
+systemd:
+  units:
+    - name: runner.service
+      enabled: true
+      contents: |
+        [Service]
+        ExecStart=/opt/runner/run.sh
+        [Install]
+        WantedBy=multi-user.target
+`,
+			want: `{"ignition":{"version":"3.3.0"},"systemd":{"units":[{"contents":"[Service]\nExecStart=/opt/runner/run.sh\n[Install]\nWantedBy=multi-user.target\n","enabled":true,"name":"runner.service"}]}}`,
+		},
+		{
+			name: "fcos boot device sugar",
+			butane: `variant: fcos
+version: 1.4.0
+boot_device:
+  mirror:
+    devices: [/dev/sda, /dev/sdb]
+`,
+			// only the shape is compared, sugar expands into the disks, raid and filesystems
+			want: "",
+		},
+		{
+			name:    "misspelled key",
+			butane:  "variant: fcos\nversion: 1.4.0\nstorage:\n  fils:\n    - path: /etc/x\n",
+			wantErr: "Unused key fils",
+		},
+		{
+			name:    "fcos sugar in flatcar",
+			butane:  "variant: flatcar\nversion: 1.0.0\nboot_device:\n  mirror:\n    devices: [/dev/sda]\n",
+			wantErr: "Unused key boot_device",
+		},
+		{
+			name:    "trees",
+			butane:  "variant: fcos\nversion: 1.4.0\nstorage:\n  trees:\n    - local: tree\n",
+			wantErr: "files directory",
+		},
+		{
+			name:    "local contents",
+			butane:  "variant: fcos\nversion: 1.4.0\nstorage:\n  files:\n    - path: /etc/x\n      contents:\n        local: x\n",
+			wantErr: "files directory",
+		},
+		{
+			name:    "warning",
+			butane:  "variant: fcos\nversion: 1.4.0\nsystemd:\n  units:\n    - name: a.service\n      enabled: true\n      contents: \"[Service]\\n\"\n",
+			wantErr: "has no install section",
+		},
+		{
+			name:    "unknown variant",
+			butane:  "variant: coreos\nversion: 1.0.0\n",
+			wantErr: "No translator exists for variant coreos",
+		},
+		{
+			name:    "unknown version",
+			butane:  "variant: fcos\nversion: 9.0.0\n",
+			wantErr: "No translator exists for variant fcos with version 9.0.0",
+		},
+		{
+			name:    "not yaml",
+			butane:  "variant: [fcos\n",
+			wantErr: "invalid butane config",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := butaneToIgnition(tt.butane)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("butaneToIgnition() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("butaneToIgnition() unexpected error: %v", err)
+			}
+			if err = validateIgnition(*got); err != nil {
+				t.Errorf("translated config is not valid: %v", err)
+			}
+			if tt.want == "" {
+				if !strings.Contains(*got, `"raid"`) || !strings.Contains(*got, `"disks"`) {
+					t.Errorf("boot device sugar was not expanded: %s", *got)
+				}
+				return
+			}
+			assertJSONEqual(t, *got, tt.want)
+		})
+	}
+}
+
+func TestValidateIgnition(t *testing.T) {
+	tests := []struct {
+		name     string
+		ignition string
+		wantErr  string
+	}{
+		{name: "valid", ignition: `{"ignition":{"version":"3.3.0"}}`},
+		{name: "older spec", ignition: `{"ignition":{"version":"3.0.0"},"storage":{"files":[{"path":"/etc/x"}]}}`},
+		{name: "unknown key", ignition: `{"ignition":{"version":"3.3.0"},"storag":{}}`, wantErr: "Unused key storag"},
+		{name: "missing version", ignition: `{"ignition":{}}`, wantErr: "invalid config version"},
+		{name: "invalid value", ignition: `{"ignition":{"version":"3.3.0"},"storage":{"files":[{"path":"relative"}]}}`, wantErr: "path not absolute"},
+		{name: "not json", ignition: `{`, wantErr: "invalid ignition config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateIgnition(tt.ignition)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateIgnition() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateIgnition() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func assertJSONEqual(t *testing.T, got, want string) {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+		t.Fatalf("invalid json %q: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid expected json %q: %v", want, err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("got json:\n%s\nwant:\n%s", got, want)
+	}
+}
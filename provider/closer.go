@@ -0,0 +1,39 @@
+package provider
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+var (
+	closers      []func() error
+	closersMutex sync.Mutex
+)
+
+// RegisterCloser registers the function that closes the API clients cached by the provider
+func RegisterCloser(closer func() error) {
+	closersMutex.Lock()
+	defer closersMutex.Unlock()
+	closers = append(closers, closer)
+}
+
+// Close closes the API clients cached by all the providers, it is called on shutdown, closers stay
+// registered and drop the closed clients from their caches so clients created afterwards are closed
+// by the next call
+func Close() error {
+	closersMutex.Lock()
+	defer closersMutex.Unlock()
+
+	var messages []string
+	for _, closer := range closers {
+		if err := closer(); err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+
+	if len(messages) > 0 {
+		return errors.New("failed closing provider clients: " + strings.Join(messages, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package provider
+
+import "testing"
+
+func TestCloseKeepsClosersRegistered(t *testing.T) {
+	calls := 0
+	RegisterCloser(func() error {
+		calls++
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := Close(); err != nil {
+			t.Fatalf("Close() unexpected error: %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("closer was called %d time(s), want it called on every Close", calls)
+	}
+}
@@ -2,20 +2,65 @@ package provider
 
 import (
 	"bytes"
-	"html/template"
+	"text/template"
 )
 
 type CloudInitData struct {
+	// GithubRepo is the repository in the owner/name format
 	GithubRepo string
+	// GithubServerURL is the GitHub server the runner registers with e.g. https://github.com
+	GithubServerURL string
+	// GithubRegistrationURL is the url passed to the config.sh --url, repository or organisation one
+	GithubRegistrationURL string
+	// GithubCABundle PEM encoded CA bundle of the GitHub enterprise server, empty if none is configured
+	GithubCABundle string
 	GithubRunnerName string
 	GithubRunnerToken string
+	// GithubRunnerJITConfig encoded just-in-time config passed to the run.sh --jitconfig, when set
+	// the runner is not configured with the token
+	GithubRunnerJITConfig string
 	GithubRunnerType string
 	GithubRunnerUniqueID string
+	// GithubRunnerLabels full list of labels runner should register with
+	GithubRunnerLabels []string
+	// GithubRunnerGroup runner group the runner should join, empty for the default group
+	GithubRunnerGroup string
+	// GithubRunnerEphemeral tells if the runner should be registered with the --ephemeral flag
+	GithubRunnerEphemeral bool
+	GithubWorkflowRunID int64
+	GithubJobID int64
+	GithubJobName string
+	// Vars are user defined variables, available in the template as .Vars
+	Vars map[string]string
 }
 
-// ParseCloudInit generates cloud-init from template
+// BuildCloudInitData builds the template data for the runner, it is shared by all the providers so
+// the templates see the same values regardless of where the runner is created
+func (b *BaseProvider) BuildCloudInitData(runnerName, runnerID string) CloudInitData {
+	return CloudInitData{
+		GithubRepo:            b.Job.Repository,
+		GithubServerURL:       b.Job.ServerURL,
+		GithubRegistrationURL: b.Job.RegistrationURL,
+		GithubCABundle:        b.Job.CABundle,
+		GithubRunnerName:      runnerName,
+		GithubRunnerToken:     b.GithubRegistrationToken,
+		GithubRunnerJITConfig: b.GithubJITConfig,
+		GithubRunnerType:      b.RunnerType,
+		GithubRunnerUniqueID:  runnerID,
+		GithubRunnerLabels:    b.Runner.Labels,
+		GithubRunnerGroup:     b.Runner.Group,
+		GithubRunnerEphemeral: b.Runner.Ephemeral,
+		GithubWorkflowRunID:   b.Job.WorkflowRunID,
+		GithubJobID:           b.Job.JobID,
+		GithubJobName:         b.Job.JobName,
+		Vars:                  b.Runner.Vars,
+	}
+}
+
+// ParseCloudInit generates cloud-init from template, values are not escaped so use the
+// quote or shellQuote functions when embedding them in YAML or shell
 func ParseCloudInit(cloudInitTemplate string, cloudInitData CloudInitData) (*string, error) {
-	t, err := template.New("cloud-init").Parse(cloudInitTemplate)
+	t, err := parseTemplate(cloudInitTemplate)
 	if err != nil {
 		return nil, err
 	}
@@ -29,3 +74,8 @@ func ParseCloudInit(cloudInitTemplate string, cloudInitData CloudInitData) (*str
 	str := buf.String()
 	return &str, nil
 }
+
+// parseTemplate parses the cloud-init template with the template function library
+func parseTemplate(cloudInitTemplate string) (*template.Template, error) {
+	return template.New("cloud-init").Funcs(templateFuncs()).Option("missingkey=error").Parse(cloudInitTemplate)
+}
@@ -0,0 +1,329 @@
+package provider
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates
+var builtinTemplates embed.FS
+
+const (
+	// builtinTemplatesDir holds the built-in templates, one per file, named by the file without extension
+	builtinTemplatesDir = "templates"
+	// builtinPartialsPattern matches the templates that are only included by the built-in ones
+	builtinPartialsPattern = "templates/partials/*"
+)
+
+// CloudInitLoader is implemented by the providers whose cloud-init needs to be loaded before use
+type CloudInitLoader interface {
+	// LoadCloudInit reads the cloud-init files and urls, relative paths are resolved against the baseDir
+	LoadCloudInit(baseDir string) error
+}
+
+// CloudInitConfig holds the cloud-init declaration shared by the providers, it can be set inline,
+// from a file or a built-in template, or as a list of parts merged into a MIME multipart user data
+type CloudInitConfig struct {
+	CloudInit *string `mapstructure:"cloud-init" yaml:"cloud-init"`
+	// CloudInitFile path to the cloud-init template, relative to the config file
+	CloudInitFile *string `mapstructure:"cloud-init-file" yaml:"cloud-init-file"`
+	// CloudInitTemplate name of the built-in cloud-init template
+	CloudInitTemplate *string `mapstructure:"cloud-init-template" yaml:"cloud-init-template"`
+	// CloudInitParts list of templates merged into the MIME multipart user data
+	CloudInitParts []CloudInitPart `mapstructure:"cloud-init-parts" yaml:"cloud-init-parts"`
+	// UserDataFormat one of cloud-init, ignition or powershell, defaults to cloud-init
+	UserDataFormat *string `mapstructure:"user-data-format" yaml:"user-data-format"`
+
+	parts []CloudInitPart
+}
+
+// CloudInitPart is a single user data template, exactly one source should be set
+type CloudInitPart struct {
+	Inline *string `mapstructure:"inline" yaml:"inline"`
+	File *string `mapstructure:"file" yaml:"file"`
+	URL *string `mapstructure:"url" yaml:"url"`
+	Template *string `mapstructure:"template" yaml:"template"`
+	// ContentType of the part within the multipart user data, detected from the content if not set
+	ContentType *string `mapstructure:"content-type" yaml:"content-type"`
+	// Vars are passed to the template as .Vars, used to parametrize the built-in templates
+	Vars map[string]string `mapstructure:"vars" yaml:"vars"`
+
+	content string
+}
+
+// LoadCloudInit reads the cloud-init templates from all the declared sources
+func (c *CloudInitConfig) LoadCloudInit(baseDir string) error {
+	var declared []CloudInitPart
+	if c.CloudInit != nil {
+		declared = append(declared, CloudInitPart{Inline: c.CloudInit})
+	}
+	if c.CloudInitFile != nil {
+		declared = append(declared, CloudInitPart{File: c.CloudInitFile})
+	}
+	if c.CloudInitTemplate != nil {
+		declared = append(declared, CloudInitPart{Template: c.CloudInitTemplate})
+	}
+	declared = append(declared, c.CloudInitParts...)
+
+	c.parts = nil
+	for i, part := range declared {
+		if err := part.load(baseDir); err != nil {
+			return fmt.Errorf("cloud-init part %d: %w", i, err)
+		}
+		c.parts = append(c.parts, part)
+	}
+
+	return c.validateUserDataFormat()
+}
+
+// HasCloudInit tells if there is any cloud-init template loaded
+func (c *CloudInitConfig) HasCloudInit() bool {
+	return len(c.parts) > 0
+}
+
+// RenderCloudInit renders the loaded templates, single template is returned as is while multiple
+// ones are merged into the MIME multipart user data
+func (c *CloudInitConfig) RenderCloudInit(cloudInitData CloudInitData) (*string, error) {
+	if len(c.parts) == 0 {
+		return nil, nil
+	}
+
+	rendered := make([]string, len(c.parts))
+	for i, part := range c.parts {
+		r, err := part.render(cloudInitData)
+		if err != nil {
+			return nil, fmt.Errorf("cloud-init part %d: %w", i, err)
+		}
+		rendered[i] = *r
+	}
+
+	if len(rendered) == 1 {
+		return &rendered[0], nil
+	}
+	return c.multipart(rendered)
+}
+
+// multipart builds MIME multipart user data, cloud-config parts are merged by cloud-init
+// instead of replacing each other
+func (c *CloudInitConfig) multipart(rendered []string) (*string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	for i, content := range rendered {
+		contentType := detectContentType(content)
+		if c.parts[i].ContentType != nil {
+			contentType = *c.parts[i].ContentType
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Type", fmt.Sprintf("%s; charset=\"utf-8\"", contentType))
+		header.Set("MIME-Version", "1.0")
+		header.Set("Content-Transfer-Encoding", "7bit")
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"part-%03d\"", i+1))
+		if contentType == "text/cloud-config" {
+			header.Set("Merge-Type", "list(append)+dict(recurse_array)+str()")
+		}
+
+		pw, err := w.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = pw.Write([]byte(content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	userData := fmt.Sprintf(
+		"Content-Type: multipart/mixed; boundary=\"%s\"\nMIME-Version: 1.0\n\n%s", w.Boundary(), body.String())
+	return &userData, nil
+}
+
+// load reads the template content from the part source and parses it, so the syntax errors are
+// reported when the config is loaded rather than when the first runner is created
+func (p *CloudInitPart) load(baseDir string) error {
+	sources := 0
+	for _, s := range []*string{p.Inline, p.File, p.URL, p.Template} {
+		if s != nil {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("expected exactly one of inline, file, url or template, got %d", sources)
+	}
+
+	switch {
+	case p.Inline != nil:
+		p.content = *p.Inline
+	case p.File != nil:
+		path := *p.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		p.content = string(content)
+	case p.URL != nil:
+		content, err := fetchTemplate(*p.URL)
+		if err != nil {
+			return err
+		}
+		p.content = content
+	case p.Template != nil:
+		_, _, err := parseBuiltinTemplate(*p.Template)
+		return err
+	}
+
+	_, err := parseTemplate(p.content)
+	return err
+}
+
+// render executes the part template, built-in templates are executed within the library
+// so they can include the shared partials
+func (p *CloudInitPart) render(cloudInitData CloudInitData) (*string, error) {
+	// part vars are the defaults, runner type vars are more specific so they take precedence
+	if p.Vars != nil {
+		vars := make(map[string]string, len(cloudInitData.Vars)+len(p.Vars))
+		for k, v := range p.Vars {
+			vars[k] = v
+		}
+		for k, v := range cloudInitData.Vars {
+			vars[k] = v
+		}
+		cloudInitData.Vars = vars
+	}
+
+	if p.Template != nil {
+		return renderBuiltinTemplate(*p.Template, cloudInitData)
+	}
+	return ParseCloudInit(p.content, cloudInitData)
+}
+
+// BuiltinTemplates returns the names of the built-in cloud-init templates
+func BuiltinTemplates() []string {
+	entries, err := builtinTemplates.ReadDir(builtinTemplatesDir)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())))
+	}
+	return names
+}
+
+// builtinTemplateFile returns the file name of the built-in template
+func builtinTemplateFile(name string) (string, error) {
+	entries, err := builtinTemplates.ReadDir(builtinTemplatesDir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())) == name {
+			return e.Name(), nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown built-in cloud-init template %q, available: %s",
+		name, strings.Join(BuiltinTemplates(), ", "))
+}
+
+// parseBuiltinTemplate parses the built-in template together with the partials, returns the template
+// and the name it is executed by
+func parseBuiltinTemplate(name string) (*template.Template, string, error) {
+	file, err := builtinTemplateFile(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	t := template.New(file)
+	funcs := templateFuncs()
+	// include renders the named template into a string so it can be piped e.g. into indent
+	funcs["include"] = func(name string, data interface{}) (string, error) {
+		var buf bytes.Buffer
+		err := t.ExecuteTemplate(&buf, name, data)
+		return buf.String(), err
+	}
+	t, err = t.Funcs(funcs).Option("missingkey=error").ParseFS(builtinTemplates, path.Join(builtinTemplatesDir, file), builtinPartialsPattern)
+	if err != nil {
+		return nil, "", err
+	}
+	return t, file, nil
+}
+
+func renderBuiltinTemplate(name string, cloudInitData CloudInitData) (*string, error) {
+	t, file, err := parseBuiltinTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = t.ExecuteTemplate(&buf, file, cloudInitData); err != nil {
+		return nil, err
+	}
+
+	str := buf.String()
+	return &str, nil
+}
+
+// fetchTemplate downloads the template from the url
+func fetchTemplate(url string) (string, error) {
+	client := http.Client{Timeout: time.Second * 30}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("didnt get expected status code(200) fetching %q, got %d", url, resp.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if len(content) == 0 {
+		return "", errors.New("fetched template is empty")
+	}
+	return string(content), nil
+}
+
+// detectContentType guesses the multipart content type by the first line, same as cloud-init does
+func detectContentType(content string) string {
+	switch {
+	case strings.HasPrefix(content, "#cloud-config"):
+		return "text/cloud-config"
+	case strings.HasPrefix(content, "#!"):
+		return "text/x-shellscript"
+	case strings.HasPrefix(content, "#include"):
+		return "text/x-include-url"
+	case strings.HasPrefix(content, "#cloud-boothook"):
+		return "text/cloud-boothook"
+	default:
+		return "text/plain"
+	}
+}
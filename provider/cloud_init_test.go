@@ -0,0 +1,274 @@
+package provider
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func testCloudInitData() CloudInitData {
+	return CloudInitData{
+		GithubRepo:            "owner/repo",
+		GithubServerURL:       "https://github.com",
+		GithubRegistrationURL: "https://github.com/owner/repo",
+		GithubRunnerName:      "runner-1-abcdef12",
+		GithubRunnerToken:     "registration-token",
+		GithubRunnerType:      "linux",
+		GithubRunnerUniqueID:  "unique-id",
+		GithubRunnerLabels:    []string{"self-hosted", "linux"},
+		GithubRunnerGroup:     "builders",
+		GithubRunnerEphemeral: true,
+		GithubWorkflowRunID:   1,
+		GithubJobID:           2,
+		GithubJobName:         "build",
+	}
+}
+
+func loadCloudInit(t *testing.T, c *CloudInitConfig) {
+	t.Helper()
+	if err := c.LoadCloudInit(t.TempDir()); err != nil {
+		t.Fatalf("LoadCloudInit() unexpected error: %v", err)
+	}
+}
+
+func TestBuiltinTemplatesRender(t *testing.T) {
+	names := BuiltinTemplates()
+	if len(names) == 0 {
+		t.Fatal("no built-in templates found")
+	}
+
+	jitData := testCloudInitData()
+	jitData.GithubRunnerToken = ""
+	jitData.GithubRunnerJITConfig = "encoded-jit-config"
+
+	for _, name := range names {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			c := &CloudInitConfig{CloudInitTemplate: &name}
+			loadCloudInit(t, c)
+
+			userData, err := c.RenderUserData(testCloudInitData())
+			if err != nil {
+				t.Fatalf("RenderUserData() unexpected error: %v", err)
+			}
+			for _, want := range []string{
+				"#cloud-config",
+				"RUNNER_SHA256='29fc8cf2dab4c195bb147384e7e2c94cfd4d4022c793b346a6175435265aa278'",
+				"--url 'https://github.com/owner/repo'",
+				"--token 'registration-token'",
+				"--name 'runner-1-abcdef12'",
+				"--labels 'self-hosted,linux'",
+				"--runnergroup 'builders'",
+				"--ephemeral",
+			} {
+				if !strings.Contains(*userData, want) {
+					t.Errorf("rendered template is missing %q:\n%s", want, *userData)
+				}
+			}
+			if strings.Contains(*userData, "--jitconfig") {
+				t.Error("token registered runner must not be started with the JIT config")
+			}
+
+			userData, err = c.RenderUserData(jitData)
+			if err != nil {
+				t.Fatalf("RenderUserData() with the JIT config unexpected error: %v", err)
+			}
+			if !strings.Contains(*userData, "./run.sh --jitconfig 'encoded-jit-config'") {
+				t.Errorf("JIT configured runner is not started with the JIT config:\n%s", *userData)
+			}
+			// --jitconfig is only understood by runner 2.300.0 and later, the default must support it
+			if !strings.Contains(*userData, "RUNNER_VERSION='2.311.0'") {
+				t.Errorf("JIT configured runner does not default to a runner supporting --jitconfig:\n%s", *userData)
+			}
+			if strings.Contains(*userData, "config.sh") {
+				t.Error("JIT configured runner must not be configured with the token")
+			}
+		})
+	}
+}
+
+func TestRunnerVersionOverride(t *testing.T) {
+	name := "ubuntu-runner"
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		want    string
+		wantErr bool
+	}{
+		{name: "default version", want: "RUNNER_VERSION='2.311.0'"},
+		{name: "version without checksum", vars: map[string]string{"runner_version": "2.285.0"}, wantErr: true},
+		{name: "arch without checksum", vars: map[string]string{"runner_arch": "arm64"}, wantErr: true},
+		{
+			name: "version with checksum",
+			vars: map[string]string{"runner_version": "2.285.0", "runner_sha256": "abc123"},
+			want: "RUNNER_SHA256='abc123'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &CloudInitConfig{CloudInitTemplate: &name}
+			loadCloudInit(t, c)
+
+			data := testCloudInitData()
+			data.Vars = tt.vars
+			userData, err := c.RenderUserData(data)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "runner_sha256 var must be set") {
+					t.Fatalf("RenderUserData() error = %v, want the missing checksum error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderUserData() unexpected error: %v", err)
+			}
+			if !strings.Contains(*userData, tt.want) {
+				t.Errorf("rendered template is missing %q", tt.want)
+			}
+		})
+	}
+}
+
+func TestCABundleRender(t *testing.T) {
+	name := "ubuntu-runner"
+	c := &CloudInitConfig{CloudInitTemplate: &name}
+	loadCloudInit(t, c)
+
+	userData, err := c.RenderUserData(testCloudInitData())
+	if err != nil {
+		t.Fatalf("RenderUserData() unexpected error: %v", err)
+	}
+	if strings.Contains(*userData, "update-ca-certificates") {
+		t.Error("CA bundle must not be installed when none is configured")
+	}
+
+	data := testCloudInitData()
+	data.GithubCABundle = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+	userData, err = c.RenderUserData(data)
+	if err != nil {
+		t.Fatalf("RenderUserData() unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"MIIB",
+		"update-ca-certificates",
+		"NODE_EXTRA_CA_CERTS=/usr/local/share/ca-certificates/gh-runner-ctl.crt",
+	} {
+		if !strings.Contains(*userData, want) {
+			t.Errorf("rendered template is missing %q:\n%s", want, *userData)
+		}
+	}
+}
+
+func TestRenderMultipart(t *testing.T) {
+	name := "ubuntu-docker-runner"
+	script := "#!/bin/bash\necho {{ .GithubRunnerName }}\n"
+	config := "#cloud-config\npackages:\n  - jq\n"
+	c := &CloudInitConfig{CloudInitParts: []CloudInitPart{
+		{Template: &name},
+		{Inline: &script},
+		{Inline: &config},
+	}}
+	loadCloudInit(t, c)
+
+	userData, err := c.RenderUserData(testCloudInitData())
+	if err != nil {
+		t.Fatalf("RenderUserData() unexpected error: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(*userData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("user data is not multipart, got %q: %v", mediaType, err)
+	}
+
+	wantTypes := []string{"text/cloud-config", "text/x-shellscript", "text/cloud-config"}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for i := 0; ; i++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			if i != len(wantTypes) {
+				t.Fatalf("got %d parts, want %d", i, len(wantTypes))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if contentType != wantTypes[i] {
+			t.Errorf("part %d content type = %q, want %q", i, contentType, wantTypes[i])
+		}
+		if contentType == "text/cloud-config" && part.Header.Get("Merge-Type") == "" {
+			t.Errorf("cloud-config part %d has no merge type", i)
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = validateCloudInit(string(content)); err != nil {
+			t.Errorf("part %d is not valid: %v", i, err)
+		}
+		if i == 1 && !strings.Contains(string(content), "echo runner-1-abcdef12") {
+			t.Errorf("inline part was not rendered: %q", content)
+		}
+	}
+}
+
+func TestLoadCloudInitParsesTemplates(t *testing.T) {
+	broken := "#cloud-config\nruncmd:\n  - echo {{ .GithubRunnerName \n"
+	unknown := "no-such-template"
+	tests := []struct {
+		name    string
+		config  *CloudInitConfig
+		wantErr string
+	}{
+		{"inline syntax error", &CloudInitConfig{CloudInit: &broken}, "unclosed action"},
+		{"part syntax error", &CloudInitConfig{CloudInitParts: []CloudInitPart{{Inline: &broken}}}, "unclosed action"},
+		{"unknown function", &CloudInitConfig{CloudInit: strPtr("{{ .GithubRunnerName | nope }}")}, `function "nope" not defined`},
+		{"unknown built-in template", &CloudInitConfig{CloudInitTemplate: &unknown}, "unknown built-in cloud-init template"},
+		{"missing file", &CloudInitConfig{CloudInitFile: strPtr("missing.yaml")}, "missing.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.LoadCloudInit(t.TempDir())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadCloudInit() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestRunnerSpecClone(t *testing.T) {
+	spec := RunnerSpec{
+		Labels: []string{"linux"},
+		Group:  "builders",
+		Vars:   map[string]string{"runner_version": "2.284.0"},
+	}
+
+	c := spec.Clone()
+	c.Labels[0] = "windows"
+	c.Labels = append(c.Labels, "x64")
+	c.Vars["runner_version"] = "2.285.0"
+	c.Vars["runner_arch"] = "arm64"
+
+	if len(spec.Labels) != 1 || spec.Labels[0] != "linux" {
+		t.Errorf("clone shares the labels with the spec: %v", spec.Labels)
+	}
+	if len(spec.Vars) != 1 || spec.Vars["runner_version"] != "2.284.0" {
+		t.Errorf("clone shares the vars with the spec: %v", spec.Vars)
+	}
+	if c.Group != spec.Group {
+		t.Errorf("clone group = %q, want %q", c.Group, spec.Group)
+	}
+}
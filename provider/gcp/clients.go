@@ -0,0 +1,218 @@
+package gcp
+
+import (
+	compute "cloud.google.com/go/compute/apiv1"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/76creates/runner-cli/log"
+	"github.com/76creates/runner-cli/provider"
+	"google.golang.org/api/option"
+	"strings"
+	"sync"
+)
+
+// clients holds the compute clients for one set of credentials, they are created on the first use
+// and shared by all the runner types and jobs using the same credentials
+type clients struct {
+	mutex sync.Mutex
+	opts  []option.ClientOption
+
+	instances         *compute.InstancesClient
+	instanceTemplates *compute.InstanceTemplatesClient
+	zoneOperations    *compute.ZoneOperationsClient
+	groupManagers     *compute.InstanceGroupManagersClient
+	regions           *compute.RegionsClient
+}
+
+var (
+	// clientCache holds the clients per credentials
+	clientCache      = make(map[string]*clients)
+	clientCacheMutex sync.Mutex
+
+	// endpointOptions are appended to the options of every client, tests point the clients to a fake API with them
+	endpointOptions []option.ClientOption
+)
+
+func init() {
+	provider.RegisterCloser(closeClients)
+}
+
+// getClients returns the cached clients for the credentials of the runner
+func (r *RunnerConfig) getClients() (*clients, error) {
+	key := r.accessKey()
+
+	clientCacheMutex.Lock()
+	defer clientCacheMutex.Unlock()
+	if c, ok := clientCache[key]; ok {
+		return c, nil
+	}
+
+	// clients outlive the context of a single call so they are not bound to it
+	opts, err := r.clientOptions(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	c := &clients{opts: append(opts, endpointOptions...)}
+	clientCache[key] = c
+	return c, nil
+}
+
+// accessKey identifies the credentials, secret values are hashed
+func (r *RunnerConfig) accessKey() string {
+	access := r.Access
+	if access == nil {
+		access = new(AccessConfig)
+	}
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	json := ""
+	if access.JSON != nil {
+		json = access.JSON.Value()
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		json,
+		value(access.KeyFile),
+		value(access.WorkloadIdentityConfig),
+		value(access.ImpersonateServiceAccount),
+		strings.Join(access.Delegates, ","),
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *RunnerConfig) instancesClient() (*compute.InstancesClient, error) {
+	c, err := r.getClients()
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.instances == nil {
+		log.Debug("getting instance client")
+		if c.instances, err = compute.NewInstancesRESTClient(context.Background(), c.opts...); err != nil {
+			return nil, err
+		}
+	}
+	return c.instances, nil
+}
+
+func (r *RunnerConfig) instanceTemplatesClient() (*compute.InstanceTemplatesClient, error) {
+	c, err := r.getClients()
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.instanceTemplates == nil {
+		log.Debug("getting instance template client")
+		if c.instanceTemplates, err = compute.NewInstanceTemplatesRESTClient(context.Background(), c.opts...); err != nil {
+			return nil, err
+		}
+	}
+	return c.instanceTemplates, nil
+}
+
+func (r *RunnerConfig) zoneOperationsClient() (*compute.ZoneOperationsClient, error) {
+	c, err := r.getClients()
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.zoneOperations == nil {
+		log.Debug("getting zone op client")
+		if c.zoneOperations, err = compute.NewZoneOperationsRESTClient(context.Background(), c.opts...); err != nil {
+			return nil, err
+		}
+	}
+	return c.zoneOperations, nil
+}
+
+func (r *RunnerConfig) groupManagersClient() (*compute.InstanceGroupManagersClient, error) {
+	c, err := r.getClients()
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.groupManagers == nil {
+		log.Debug("getting instance group manager client")
+		if c.groupManagers, err = compute.NewInstanceGroupManagersRESTClient(context.Background(), c.opts...); err != nil {
+			return nil, err
+		}
+	}
+	return c.groupManagers, nil
+}
+
+func (r *RunnerConfig) regionsClient() (*compute.RegionsClient, error) {
+	c, err := r.getClients()
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.regions == nil {
+		log.Debug("getting region client")
+		if c.regions, err = compute.NewRegionsRESTClient(context.Background(), c.opts...); err != nil {
+			return nil, err
+		}
+	}
+	return c.regions, nil
+}
+
+// close closes the clients that were created
+func (c *clients) close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var messages []string
+	collect := func(err error) {
+		if err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+	if c.instances != nil {
+		collect(c.instances.Close())
+	}
+	if c.instanceTemplates != nil {
+		collect(c.instanceTemplates.Close())
+	}
+	if c.zoneOperations != nil {
+		collect(c.zoneOperations.Close())
+	}
+	if c.groupManagers != nil {
+		collect(c.groupManagers.Close())
+	}
+	if c.regions != nil {
+		collect(c.regions.Close())
+	}
+
+	if len(messages) > 0 {
+		return fmt.Errorf("gcp: %s", strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+// closeClients closes all the cached clients, next use creates them again
+func closeClients() error {
+	clientCacheMutex.Lock()
+	defer clientCacheMutex.Unlock()
+
+	var messages []string
+	for key, c := range clientCache {
+		if err := c.close(); err != nil {
+			messages = append(messages, err.Error())
+		}
+		delete(clientCache, key)
+	}
+	if len(messages) > 0 {
+		return fmt.Errorf("%s", strings.Join(messages, "; "))
+	}
+	return nil
+}
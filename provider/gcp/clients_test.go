@@ -0,0 +1,194 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/76creates/runner-cli/provider"
+	"google.golang.org/api/option"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeComputeAPI serves the compute REST calls of the instance create and destroy, instance is
+// created right away and gone once deleted, the instance resource of the last insert is kept
+type fakeComputeAPI struct {
+	mu        sync.Mutex
+	instances map[string]bool
+	inserted  *computepb.Instance
+	// insertZones zones the inserts were made in, in order
+	insertZones []string
+	// operationErrors error code the operations of the zone finish with, instance is not created in it
+	operationErrors map[string]string
+	// regionZones zones of the test-region
+	regionZones []string
+	// pendingOperations operations are never done
+	pendingOperations bool
+	// lingering how many lookups still find the instance after its delete, negative keeps it forever
+	lingering map[string]int
+	deleting  map[string]bool
+	lookups   int
+}
+
+// newFakeComputeAPI starts the fake compute API and points the clients to it
+func newFakeComputeAPI(t *testing.T) *fakeComputeAPI {
+	api := &fakeComputeAPI{
+		instances:       make(map[string]bool),
+		operationErrors: make(map[string]string),
+		lingering:       make(map[string]int),
+		deleting:        make(map[string]bool),
+	}
+	server := httptest.NewServer(api)
+	endpointOptions = []option.ClientOption{option.WithEndpoint(server.URL), option.WithoutAuthentication()}
+	t.Cleanup(func() {
+		if err := provider.Close(); err != nil {
+			t.Errorf("Close() unexpected error: %v", err)
+		}
+		endpointOptions = nil
+		server.Close()
+	})
+	return api
+}
+
+func (f *fakeComputeAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	const prefix = "/compute/v1/projects/test-project/"
+	path := strings.TrimPrefix(req.URL.Path, prefix)
+	if req.Method == http.MethodGet && path == "regions/test-region" {
+		var zoneURLs []string
+		for _, zone := range f.regionZones {
+			zoneURLs = append(zoneURLs, "https://www.googleapis.com/compute/v1/projects/test-project/zones/"+zone)
+		}
+		writeJSON(w, map[string]interface{}{"name": "test-region", "zones": zoneURLs})
+		return
+	}
+
+	// zones/<zone>/<resource>
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) != 3 || parts[0] != "zones" {
+		http.Error(w, "unexpected request "+req.Method+" "+req.URL.Path, http.StatusNotImplemented)
+		return
+	}
+	zone, path := parts[1], parts[2]
+	operation := map[string]interface{}{"name": "operation", "status": "DONE"}
+	switch {
+	case req.Method == http.MethodPost && path == "instances":
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		instance := new(computepb.Instance)
+		if err := protojson.Unmarshal(body, instance); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.insertZones = append(f.insertZones, zone)
+		if f.operationErrors[zone] == "" {
+			f.instances[instance.GetName()] = true
+			f.inserted = instance
+		}
+	case req.Method == http.MethodPost && strings.HasPrefix(path, "operations/"):
+		if f.pendingOperations {
+			operation["status"] = "RUNNING"
+		}
+		if code := f.operationErrors[zone]; code != "" {
+			operation["error"] = map[string]interface{}{
+				"errors": []map[string]string{{"code": code, "message": "operation failed in " + zone}},
+			}
+		}
+	case req.Method == http.MethodDelete && strings.HasPrefix(path, "instances/"):
+		name := strings.TrimPrefix(path, "instances/")
+		if !f.instances[name] {
+			http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+			return
+		}
+		if f.lingering[name] == 0 {
+			delete(f.instances, name)
+		} else {
+			f.deleting[name] = true
+		}
+	case req.Method == http.MethodGet && strings.HasPrefix(path, "instances/"):
+		name := strings.TrimPrefix(path, "instances/")
+		f.lookups++
+		if f.deleting[name] && f.lingering[name] == 0 {
+			delete(f.instances, name)
+			delete(f.deleting, name)
+		}
+		if !f.instances[name] {
+			http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+			return
+		}
+		status := "RUNNING"
+		if f.deleting[name] {
+			status = "STOPPING"
+			if f.lingering[name] > 0 {
+				f.lingering[name]--
+			}
+		}
+		operation = map[string]interface{}{"name": name, "status": status}
+	default:
+		http.Error(w, "unexpected request "+req.Method+" "+req.URL.Path, http.StatusNotImplemented)
+		return
+	}
+
+	writeJSON(w, operation)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestClientsAreReusedAcrossInstances(t *testing.T) {
+	api := newFakeComputeAPI(t)
+
+	base := &RunnerConfig{
+		Project:     proto.String("test-project"),
+		Zone:        proto.String("test-zone"),
+		MachineType: proto.String("e2-small"),
+		Image:       proto.String("projects/debian-cloud/global/images/family/debian-11"),
+	}
+
+	var first *clients
+	for i := 0; i < 3; i++ {
+		r := base.Clone().(*RunnerConfig)
+		name := "runner-" + string(rune('a'+i))
+		if err := r.CreateInstance(context.Background(), name); err != nil {
+			t.Fatalf("CreateInstance() unexpected error: %v", err)
+		}
+		if err := r.DestroyInstance(context.Background(), name); err != nil {
+			t.Fatalf("DestroyInstance() unexpected error: %v", err)
+		}
+
+		clientCacheMutex.Lock()
+		if len(clientCache) != 1 {
+			t.Errorf("client cache holds %d set(s) of clients, want 1", len(clientCache))
+		}
+		c := clientCache[r.accessKey()]
+		clientCacheMutex.Unlock()
+
+		if first == nil {
+			first = c
+			continue
+		}
+		if c != first || c.instances != first.instances || c.zoneOperations != first.zoneOperations {
+			t.Errorf("cycle %d built a new set of clients", i)
+		}
+	}
+	if first == nil || first.instances == nil || first.zoneOperations == nil {
+		t.Fatal("clients were not built")
+	}
+	if len(api.instances) != 0 {
+		t.Errorf("instances left behind: %v", api.instances)
+	}
+}
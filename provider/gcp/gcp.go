@@ -3,118 +3,511 @@ package gcp
 import (
 	compute "cloud.google.com/go/compute/apiv1"
 	"context"
+	"errors"
 	"fmt"
-	"github.com/76creates/runner-cli/ghCtl"
 	"github.com/76creates/runner-cli/log"
 	"github.com/76creates/runner-cli/provider"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
 	"google.golang.org/protobuf/proto"
+	"net/http"
+	"path"
+	"strings"
+	"time"
 )
 
-// getClientAuthOption return option for authentification client, contains json credentials
-func (r *RunnerConfig)getClientAuthOption() option.ClientOption{
-	return option.WithCredentialsJSON([]byte(*r.Access.JSON))
+// clientOptions returns the options the compute clients authenticate with, see the AccessConfig
+func (r *RunnerConfig)clientOptions(ctx context.Context) ([]option.ClientOption, error) {
+	var opts []option.ClientOption
+	access := r.Access
+	if access == nil {
+		access = new(AccessConfig)
+	}
+
+	switch {
+	case access.JSON != nil:
+		opts = append(opts, option.WithCredentialsJSON([]byte(access.JSON.Value())))
+	case access.KeyFile != nil:
+		opts = append(opts, option.WithCredentialsFile(*access.KeyFile))
+	case access.WorkloadIdentityConfig != nil:
+		// external account config is loaded the same way as the key file
+		opts = append(opts, option.WithCredentialsFile(*access.WorkloadIdentityConfig))
+	default:
+		log.Debug("no gcp credentials set, using the application default credentials")
+	}
+
+	if access.ImpersonateServiceAccount != nil {
+		tokenSource, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+			TargetPrincipal: *access.ImpersonateServiceAccount,
+			Scopes:          []string{"https://www.googleapis.com/auth/cloud-platform"},
+			Delegates:       access.Delegates,
+		}, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("could not impersonate the service account %q: %w", *access.ImpersonateServiceAccount, err)
+		}
+		opts = []option.ClientOption{option.WithTokenSource(tokenSource)}
+	}
+
+	return opts, nil
 }
 
 func (r *RunnerConfig)createMachine(ctx context.Context, runnerInstanceName string, cloudInit *string) (*compute.Operation, error) {
 	log.Debug("creating machine")
 
-	log.Debug("getting instance client")
-	clientInstance, err := compute.NewInstancesRESTClient(ctx, r.getClientAuthOption())
+	if r.ManagedInstanceGroup != nil {
+		return r.createGroupMachine(ctx, runnerInstanceName, cloudInit)
+	}
+	if r.InstanceTemplate != nil {
+		return r.createMachineFromTemplate(ctx, runnerInstanceName, cloudInit)
+	}
+
+	clientInstance, err := r.instancesClient()
 	if err != nil {
 		return nil, err
 	}
-	defer clientInstance.Close()
 
 	req := &computepb.InsertInstanceRequest{
 		Project: *r.Project,
-		Zone:    *r.Zone,
+		Zone:    r.instanceZone(),
 		InstanceResource: &computepb.Instance{
 			Name: proto.String(runnerInstanceName),
-			Disks: []*computepb.AttachedDisk{
-				{
-					InitializeParams: &computepb.AttachedDiskInitializeParams{
-						DiskSizeGb:  proto.Int64(10),
-						SourceImage: r.Image,
-					},
-					AutoDelete: proto.Bool(true),
-					Boot:       proto.Bool(true),
-					Type:       computepb.AttachedDisk_PERSISTENT.Enum(),
-				},
-			},
-			MachineType: proto.String(fmt.Sprintf("zones/%s/machineTypes/%s", *r.Zone, *r.MachineType)),
-			NetworkInterfaces: []*computepb.NetworkInterface{
-				{
-					Name: r.NetworkName,
-					AccessConfigs: []*computepb.AccessConfig{
-						{
-							Type: computepb.AccessConfig_ONE_TO_ONE_NAT.Enum(),
-							Name: proto.String("External NAT"),
-						},
-					},
-				},
-			},
+			Disks: r.disks(),
+			MachineType: proto.String(fmt.Sprintf("zones/%s/machineTypes/%s", r.instanceZone(), *r.MachineType)),
+			NetworkInterfaces: []*computepb.NetworkInterface{r.networkInterface()},
+			Labels: r.Labels,
+			MinCpuPlatform: r.MinCPUPlatform,
 		},
 	}
+	if len(r.NetworkTags) > 0 {
+		req.InstanceResource.Tags = &computepb.Tags{Items: r.NetworkTags}
+	}
+	if r.ServiceAccount != nil {
+		scopes := r.ServiceAccount.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"https://www.googleapis.com/auth/cloud-platform"}
+		}
+		req.InstanceResource.ServiceAccounts = []*computepb.ServiceAccount{
+			{Email: proto.String(r.ServiceAccount.Email), Scopes: scopes},
+		}
+	}
+	if r.ShieldedVM != nil {
+		req.InstanceResource.ShieldedInstanceConfig = &computepb.ShieldedInstanceConfig{
+			EnableSecureBoot:          r.ShieldedVM.SecureBoot,
+			EnableVtpm:                r.ShieldedVM.VTPM,
+			EnableIntegrityMonitoring: r.ShieldedVM.IntegrityMonitoring,
+		}
+	}
 
+	scheduling, err := r.scheduling()
+	if err != nil {
+		return nil, err
+	}
+	req.InstanceResource.Scheduling = scheduling
 
 	// add cloud-init script to instance
-	userDataKey := "user-data"
+	req.InstanceResource.Metadata = r.userDataMetadata(cloudInit)
+
+	log.Debug("making an request")
+	return clientInstance.Insert(ctx, req)
+}
+
+// createMachineFromTemplate creates the instance from the instance template, metadata set on the instance
+// replaces the one of the template so the template items are carried over with only the user data set
+func (r *RunnerConfig)createMachineFromTemplate(ctx context.Context, runnerInstanceName string, cloudInit *string) (*compute.Operation, error) {
+	log.DebugF("creating machine from the instance template %q", *r.InstanceTemplate)
+
+	clientInstance, err := r.instancesClient()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := r.instanceTemplateMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &computepb.InsertInstanceRequest{
+		Project: *r.Project,
+		Zone:    r.instanceZone(),
+		SourceInstanceTemplate: proto.String(r.instanceTemplateURL()),
+		InstanceResource: &computepb.Instance{
+			Name: proto.String(runnerInstanceName),
+			Metadata: r.withUserData(metadata, cloudInit),
+		},
+	}
+
+	log.Debug("making an request")
+	return clientInstance.Insert(ctx, req)
+}
+
+// createGroupMachine adds the named instance to the managed instance group, which increases its
+// target size, user data is set as the preserved state metadata of the instance
+func (r *RunnerConfig)createGroupMachine(ctx context.Context, runnerInstanceName string, cloudInit *string) (*compute.Operation, error) {
+	log.DebugF("creating machine in the managed instance group %q", *r.ManagedInstanceGroup)
+
+	clientGroup, err := r.groupManagersClient()
+	if err != nil {
+		return nil, err
+	}
+
+	instanceConfig := &computepb.PerInstanceConfig{Name: proto.String(runnerInstanceName)}
+	if cloudInit != nil {
+		instanceConfig.PreservedState = &computepb.PreservedState{
+			Metadata: map[string]string{r.userDataMetadataKey(): *cloudInit},
+		}
+	}
+	req := &computepb.CreateInstancesInstanceGroupManagerRequest{
+		Project: *r.Project,
+		Zone:    r.instanceZone(),
+		InstanceGroupManager: *r.ManagedInstanceGroup,
+		InstanceGroupManagersCreateInstancesRequestResource: &computepb.InstanceGroupManagersCreateInstancesRequest{
+			Instances: []*computepb.PerInstanceConfig{instanceConfig},
+		},
+	}
+
+	log.Debug("making an request")
+	return clientGroup.CreateInstances(ctx, req)
+}
+
+// waitForGroupMachine waits for the managed instance group to create the instance, operation of the
+// create request is done once the group accepts it while the instance is created by the group afterwards
+func (r *RunnerConfig)waitForGroupMachine(ctx context.Context, op *compute.Operation, instanceName string) error {
+	clientGroup, err := r.groupManagersClient()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(r.GetOperationTimeout())
+	for {
+		instance, err := r.groupManagedInstance(ctx, clientGroup, instanceName)
+		if err != nil {
+			return err
+		}
+
+		status := ""
+		if instance != nil {
+			// group keeps retrying the failed create, last attempt tells why it did not succeed
+			if lastErr := instance.GetLastAttempt().GetErrors(); lastErr.GetCode() != "" || lastErr.GetMessage() != "" {
+				return &OperationError{operation: op.Proto().GetName(), errors: []*computepb.Errors{lastErr}}
+			}
+			status = instance.GetInstanceStatus()
+			if status == computepb.ManagedInstance_RUNNING.String() {
+				log.DebugF("machine with ID %q is running in the managed instance group %q", instanceName, *r.ManagedInstanceGroup)
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("machine with ID %q was not running in the managed instance group %q after %s, status %q", instanceName, *r.ManagedInstanceGroup, r.GetOperationTimeout(), status)
+		}
+
+		log.DebugF("machine with ID %q is not running yet in the managed instance group, status %q", instanceName, status)
+		time.Sleep(time.Second * 5)
+	}
+}
+
+// groupManagedInstance returns the named instance of the managed instance group, nil if the group has
+// not listed it yet
+func (r *RunnerConfig)groupManagedInstance(ctx context.Context, clientGroup *compute.InstanceGroupManagersClient, instanceName string) (*computepb.ManagedInstance, error) {
+	it := clientGroup.ListManagedInstances(ctx, &computepb.ListManagedInstancesInstanceGroupManagersRequest{
+		Project: *r.Project,
+		Zone:    r.instanceZone(),
+		InstanceGroupManager: *r.ManagedInstanceGroup,
+	})
+	for {
+		instance, err := it.Next()
+		if err == iterator.Done {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if path.Base(instance.GetInstance()) == instanceName {
+			return instance, nil
+		}
+	}
+}
+
+// destroyGroupMachine deletes the instance from the managed instance group, which decreases its target size
+func (r *RunnerConfig)destroyGroupMachine(ctx context.Context, instanceName string) (*compute.Operation, error) {
+	clientGroup, err := r.groupManagersClient()
+	if err != nil {
+		return nil, err
+	}
+
+	req := &computepb.DeleteInstancesInstanceGroupManagerRequest{
+		Project: *r.Project,
+		Zone:    r.instanceZone(),
+		InstanceGroupManager: *r.ManagedInstanceGroup,
+		InstanceGroupManagersDeleteInstancesRequestResource: &computepb.InstanceGroupManagersDeleteInstancesRequest{
+			Instances: []string{fmt.Sprintf("zones/%s/instances/%s", r.instanceZone(), instanceName)},
+			SkipInstancesOnValidationError: proto.Bool(true),
+		},
+	}
+
+	log.DebugF("deleting a machine with ID %q from the managed instance group %q", instanceName, *r.ManagedInstanceGroup)
+	return clientGroup.DeleteInstances(ctx, req)
+}
+
+// instanceTemplateMetadata returns the metadata items of the instance template
+func (r *RunnerConfig)instanceTemplateMetadata(ctx context.Context) ([]*computepb.Items, error) {
+	clientTemplates, err := r.instanceTemplatesClient()
+	if err != nil {
+		return nil, err
+	}
+
+	project, name := r.instanceTemplateRef()
+	template, err := clientTemplates.Get(ctx, &computepb.GetInstanceTemplateRequest{
+		Project:          project,
+		InstanceTemplate: name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not get the instance template %q: %w", *r.InstanceTemplate, err)
+	}
+	return template.GetProperties().GetMetadata().GetItems(), nil
+}
+
+// withUserData returns the metadata with the items given and the user data, user data item replaces the
+// one with the same key, items are left as they are if there is no user data
+func (r *RunnerConfig)withUserData(items []*computepb.Items, cloudInit *string) *computepb.Metadata {
+	metadata := new(computepb.Metadata)
+	for _, item := range items {
+		if cloudInit != nil && item.GetKey() == r.userDataMetadataKey() {
+			continue
+		}
+		metadata.Items = append(metadata.Items, item)
+	}
+	if cloudInit != nil {
+		metadata.Items = append(metadata.Items, r.userDataMetadata(cloudInit).Items...)
+	}
+	return metadata
+}
+
+// userDataMetadata returns the instance metadata holding the user data
+func (r *RunnerConfig)userDataMetadata(cloudInit *string) *computepb.Metadata {
+	userDataKey := r.userDataMetadataKey()
 	userData := computepb.Items{
 		Key: &userDataKey,
 		Value: cloudInit,
 	}
 	metadata := new(computepb.Metadata)
 	metadata.Items = append(metadata.Items, &userData)
-	req.InstanceResource.Metadata = metadata
+	return metadata
+}
 
-	log.Debug("making an request")
-	return clientInstance.Insert(ctx, req)
+// disks returns the boot disk and the local SSDs if any are requested
+func (r *RunnerConfig)disks() []*computepb.AttachedDisk {
+	bootDiskSize := int64(10)
+	if r.BootDiskSize != nil {
+		bootDiskSize = *r.BootDiskSize
+	}
+	boot := &computepb.AttachedDisk{
+		InitializeParams: &computepb.AttachedDiskInitializeParams{
+			DiskSizeGb:  proto.Int64(bootDiskSize),
+			SourceImage: r.Image,
+		},
+		AutoDelete: proto.Bool(true),
+		Boot:       proto.Bool(true),
+		Type:       proto.String(computepb.AttachedDisk_PERSISTENT.String()),
+	}
+	if r.BootDiskType != nil {
+		boot.InitializeParams.DiskType = proto.String(fmt.Sprintf("zones/%s/diskTypes/%s", r.instanceZone(), *r.BootDiskType))
+	}
+
+	disks := []*computepb.AttachedDisk{boot}
+	if r.LocalSSDs != nil {
+		for i := 0; i < *r.LocalSSDs; i++ {
+			disks = append(disks, &computepb.AttachedDisk{
+				InitializeParams: &computepb.AttachedDiskInitializeParams{
+					DiskType: proto.String(fmt.Sprintf("zones/%s/diskTypes/local-ssd", r.instanceZone())),
+				},
+				AutoDelete: proto.Bool(true),
+				Interface:  proto.String(computepb.AttachedDisk_NVME.String()),
+				Type:       proto.String(computepb.AttachedDisk_SCRATCH.String()),
+			})
+		}
+	}
+	return disks
+}
+
+// networkInterface returns the instance network interface, external NAT is added unless the public
+// ip is disabled
+func (r *RunnerConfig)networkInterface() *computepb.NetworkInterface {
+	networkInterface := &computepb.NetworkInterface{
+		Name: r.NetworkName,
+		Subnetwork: r.Subnetwork,
+	}
+	if r.HasPublicIP() {
+		networkInterface.AccessConfigs = []*computepb.AccessConfig{
+			{
+				Type: proto.String(computepb.AccessConfig_ONE_TO_ONE_NAT.String()),
+				Name: proto.String("External NAT"),
+			},
+		}
+	}
+	return networkInterface
+}
+
+// scheduling returns the instance scheduling for the provisioning model, spot instance is deleted
+// on preemption so nothing is left behind
+func (r *RunnerConfig)scheduling() (*computepb.Scheduling, error) {
+	switch r.GetProvisioningModel() {
+	case ProvisioningModelStandard:
+		return nil, nil
+	case ProvisioningModelSpot:
+		return &computepb.Scheduling{
+			ProvisioningModel:         proto.String(computepb.Scheduling_SPOT.String()),
+			InstanceTerminationAction: proto.String(computepb.Scheduling_DELETE.String()),
+			OnHostMaintenance:         proto.String(computepb.Scheduling_TERMINATE.String()),
+			AutomaticRestart:          proto.Bool(false),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown provisioning model %q, expected standard or spot", r.GetProvisioningModel())
+	}
+}
+
+// instancePreempted tells if the instance was preempted, preemption is looked up in the zone
+// operations since the spot instance is deleted right after it
+func (r *RunnerConfig)instancePreempted(ctx context.Context, instanceName string) (bool, error) {
+	zoneOperationsClient, err := r.zoneOperationsClient()
+	if err != nil {
+		return false, err
+	}
+
+	it := zoneOperationsClient.List(ctx, &computepb.ListZoneOperationsRequest{
+		Project: *r.Project,
+		Zone:    r.instanceZone(),
+		Filter:  proto.String(`operationType="compute.instances.preempted"`),
+	})
+	for {
+		op, err := it.Next()
+		if err == iterator.Done {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if strings.HasSuffix(op.GetTargetLink(), "/instances/"+instanceName) {
+			return true, nil
+		}
+	}
+}
+
+// instanceStatus returns the instance status, empty string if the instance does not exist
+func (r *RunnerConfig)instanceStatus(ctx context.Context, instanceName string) (string, error) {
+	clientInstance, err := r.instancesClient()
+	if err != nil {
+		return "", err
+	}
+
+	instance, err := clientInstance.Get(ctx, &computepb.GetInstanceRequest{
+		Instance: instanceName,
+		Project:  *r.Project,
+		Zone:     r.instanceZone(),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return instance.GetStatus(), nil
+}
+
+// isNotFound tells if the compute API responded with 404
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// userDataMetadataKey returns the metadata key the guest reads the user data from, cloud-init and
+// ignition read the user-data key while windows agent runs the startup script key
+func (r *RunnerConfig)userDataMetadataKey() string {
+	if r.GetUserDataFormat() == provider.UserDataFormatPowerShell {
+		return "windows-startup-script-ps1"
+	}
+	return "user-data"
 }
 
 func (r *RunnerConfig)destroyMachine(ctx context.Context, instanceName string) error {
 	log.Debug("destroying machine")
 
-	clientInstance, err := compute.NewInstancesRESTClient(ctx, r.getClientAuthOption())
+	var op *compute.Operation
+	var err error
+	if r.ManagedInstanceGroup != nil {
+		op, err = r.destroyGroupMachine(ctx, instanceName)
+	} else {
+		op, err = r.deleteMachine(ctx, instanceName)
+	}
 	if err != nil {
+		// spot instance deletes itself when preempted
+		if isNotFound(err) {
+			log.DebugF("machine with ID %q is already deleted", instanceName)
+			return nil
+		}
+		return err
+	}
+
+	log.DebugF("waiting for the machine with ID %q to be deleted", instanceName)
+	if err = r.waitForComputeOP(ctx, op); err != nil {
 		return err
 	}
-	defer clientInstance.Close()
+
+	return r.waitForMachineAbsent(ctx, instanceName)
+}
+
+func (r *RunnerConfig)deleteMachine(ctx context.Context, instanceName string) (*compute.Operation, error) {
+	clientInstance, err := r.instancesClient()
+	if err != nil {
+		return nil, err
+	}
 
 	req := &computepb.DeleteInstanceRequest{
 		Instance: instanceName,
 		Project: *r.Project,
-		Zone: *r.Zone,
+		Zone: r.instanceZone(),
 	}
 
 	log.DebugF("deleting a machine with ID %q", req.Instance)
-	resp, err := clientInstance.Delete(ctx, req)
-	if err != nil {
-		return err
-	}
+	return clientInstance.Delete(ctx, req)
+}
 
-	// TODO: check if resp needs to be debugged for an error as well
+// machineAbsentPollInterval how often the deleted instance is looked up, tests shorten it
+var machineAbsentPollInterval = time.Second * 5
 
-	log.DebugF("deleted the machine with ID %q with the code %q", req.Instance, resp.Proto().Status.String())
-	return nil
+// waitForMachineAbsent confirms the instance is gone, managed instance group deletes the instance
+// after its operation is done so it is polled until the operation timeout
+func (r *RunnerConfig)waitForMachineAbsent(ctx context.Context, instanceName string) error {
+	deadline := time.Now().Add(r.GetOperationTimeout())
+	for {
+		status, err := r.instanceStatus(ctx, instanceName)
+		if err != nil {
+			return err
+		}
+		if status == "" {
+			log.DebugF("machine with ID %q is deleted", instanceName)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("machine with ID %q still exists with the status %q after %s", instanceName, status, r.GetOperationTimeout())
+		}
+
+		log.DebugF("machine with ID %q still exists with the status %q", instanceName, status)
+		time.Sleep(machineAbsentPollInterval)
+	}
 }
 
 func (r *RunnerConfig) parseCloudData(ctx context.Context, runnerName, runnerID string) (*string, error) {
-	if r.CloudInit == nil {
+	if !r.HasCloudInit() {
 		log.Warning("cloud init is null, nothing to parse")
 		return nil, nil
 	}
 	log.Debug("parsing cloud init")
 
-	cloudInitData := provider.CloudInitData {
-		GithubRepo: fmt.Sprintf("%s/%s", ghCtl.GetRepoOwner(ctx), ghCtl.GetRepoName(ctx)),
-		GithubRunnerName: runnerName,
-		GithubRunnerToken: r.GithubRegistrationToken,
-		GithubRunnerType: r.RunnerType,
-		GithubRunnerUniqueID: runnerID,
-	}
-	cloudInitParsed, err := provider.ParseCloudInit(*r.CloudInit, cloudInitData)
+	cloudInitData := r.BuildCloudInitData(runnerName, runnerID)
+	cloudInitParsed, err := r.RenderUserData(cloudInitData)
 	if err != nil {
 		log.Error(err.Error())
 		return nil, err
@@ -124,29 +517,38 @@ func (r *RunnerConfig) parseCloudData(ctx context.Context, runnerName, runnerID
 }
 
 
+// waitForComputeOP waits for the zone operation to be done and returns the errors it finished with,
+// it gives up after the operation timeout
 func (r *RunnerConfig) waitForComputeOP(ctx context.Context, op *compute.Operation) error {
 	log.DebugF("waiting for zone op %q", op.Proto().GetName())
 
-	log.Debug("getting zone op client")
-	zoneOperationsClient, err := compute.NewZoneOperationsRESTClient(ctx, r.getClientAuthOption())
+	ctx, cancel := context.WithTimeout(ctx, r.GetOperationTimeout())
+	defer cancel()
+
+	zoneOperationsClient, err := r.zoneOperationsClient()
 	if err != nil {
 		return err
 	}
-	defer zoneOperationsClient.Close()
 
 	for {
 		waitReq := &computepb.WaitZoneOperationRequest{
 			Operation: op.Proto().GetName(),
 			Project:   *r.Project,
-			Zone:      *r.Zone,
+			Zone:      r.instanceZone(),
 		}
 		zoneOp, err := zoneOperationsClient.Wait(ctx, waitReq)
 		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("operation %q was not done after %s", op.Proto().GetName(), r.GetOperationTimeout())
+			}
 			log.DebugF("operation %q had an error", op.Proto().GetName())
 			return err
 		}
 
 		if *zoneOp.Status.Enum() == computepb.Operation_DONE {
+			if opErrors := zoneOp.GetError().GetErrors(); len(opErrors) > 0 {
+				return &OperationError{operation: op.Proto().GetName(), errors: opErrors}
+			}
 			log.DebugF("operation %q is done", op.Proto().GetName())
 			return nil
 		}
@@ -0,0 +1,439 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestWithUserData(t *testing.T) {
+	item := func(key, value string) *computepb.Items {
+		return &computepb.Items{Key: proto.String(key), Value: proto.String(value)}
+	}
+	templateItems := []*computepb.Items{
+		item("enable-oslogin", "TRUE"),
+		item("user-data", "template user data"),
+		item("startup-script", "echo hello"),
+	}
+
+	tests := []struct {
+		name      string
+		cloudInit *string
+		want      map[string]string
+	}{
+		{
+			name:      "user data replaces the template one",
+			cloudInit: proto.String("runner user data"),
+			want: map[string]string{
+				"enable-oslogin": "TRUE",
+				"startup-script": "echo hello",
+				"user-data":      "runner user data",
+			},
+		},
+		{
+			name: "template items are kept without user data",
+			want: map[string]string{
+				"enable-oslogin": "TRUE",
+				"startup-script": "echo hello",
+				"user-data":      "template user data",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RunnerConfig{}
+			got := make(map[string]string)
+			for _, i := range r.withUserData(templateItems, tt.cloudInit).GetItems() {
+				if _, ok := got[i.GetKey()]; ok {
+					t.Errorf("metadata key %q is set more than once", i.GetKey())
+				}
+				got[i.GetKey()] = i.GetValue()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("withUserData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstanceTemplateRef(t *testing.T) {
+	tests := []struct {
+		template    string
+		wantProject string
+		wantName    string
+	}{
+		{template: "runner", wantProject: "my-project", wantName: "runner"},
+		{template: "projects/other/global/instanceTemplates/runner", wantProject: "other", wantName: "runner"},
+		{
+			template:    "https://www.googleapis.com/compute/v1/projects/other/global/instanceTemplates/runner",
+			wantProject: "other",
+			wantName:    "runner",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			r := &RunnerConfig{Project: proto.String("my-project"), InstanceTemplate: proto.String(tt.template)}
+			project, name := r.instanceTemplateRef()
+			if project != tt.wantProject || name != tt.wantName {
+				t.Errorf("instanceTemplateRef() = %q, %q, want %q, %q", project, name, tt.wantProject, tt.wantName)
+			}
+		})
+	}
+}
+
+// testRunnerConfig returns the minimal runner config the fake compute API serves
+func testRunnerConfig() *RunnerConfig {
+	return &RunnerConfig{
+		Project:     proto.String("test-project"),
+		Zone:        proto.String("test-zone"),
+		MachineType: proto.String("e2-small"),
+		Image:       proto.String("projects/debian-cloud/global/images/family/debian-11"),
+	}
+}
+
+// insertedInstance creates the instance with the fake compute API and returns the instance resource it received
+func insertedInstance(t *testing.T, api *fakeComputeAPI, r *RunnerConfig) *computepb.Instance {
+	t.Helper()
+	if _, err := r.createMachine(context.Background(), "runner-1", proto.String("user data")); err != nil {
+		t.Fatalf("createMachine() unexpected error: %v", err)
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if api.inserted == nil {
+		t.Fatal("no instance was inserted")
+	}
+	return api.inserted
+}
+
+func TestCreateMachineScheduling(t *testing.T) {
+	api := newFakeComputeAPI(t)
+
+	tests := []struct {
+		name              string
+		provisioningModel *string
+		onDemand          bool
+		wantSpot          bool
+		wantErr           bool
+	}{
+		{name: "standard by default"},
+		{name: "standard", provisioningModel: proto.String("standard")},
+		{name: "spot", provisioningModel: proto.String("spot"), wantSpot: true},
+		{name: "spot is case insensitive", provisioningModel: proto.String("SPOT"), wantSpot: true},
+		{name: "spot falls back to standard", provisioningModel: proto.String("spot"), onDemand: true},
+		{name: "unknown model", provisioningModel: proto.String("preemptible"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRunnerConfig()
+			r.ProvisioningModel = tt.provisioningModel
+			if tt.onDemand {
+				r.WithOnDemand()
+			}
+
+			if tt.wantErr {
+				if _, err := r.createMachine(context.Background(), "runner-1", nil); err == nil {
+					t.Fatal("createMachine() expected an error for the unknown provisioning model")
+				}
+				return
+			}
+
+			scheduling := insertedInstance(t, api, r).GetScheduling()
+			if !tt.wantSpot {
+				if scheduling.GetProvisioningModel() == computepb.Scheduling_SPOT.String() {
+					t.Errorf("standard instance is scheduled as spot: %v", scheduling)
+				}
+				return
+			}
+			if got := scheduling.GetProvisioningModel(); got != computepb.Scheduling_SPOT.String() {
+				t.Errorf("provisioning model = %q, want SPOT", got)
+			}
+			if got := scheduling.GetInstanceTerminationAction(); got != computepb.Scheduling_DELETE.String() {
+				t.Errorf("termination action = %q, want DELETE", got)
+			}
+			if got := scheduling.GetOnHostMaintenance(); got != computepb.Scheduling_TERMINATE.String() {
+				t.Errorf("on host maintenance = %q, want TERMINATE", got)
+			}
+			if scheduling.AutomaticRestart == nil || scheduling.GetAutomaticRestart() {
+				t.Error("spot instance must not be restarted automatically")
+			}
+		})
+	}
+}
+
+func TestPreemptionLimit(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxPreemptions *int
+		want           int
+	}{
+		{name: "default", want: 2},
+		{name: "no preemption tolerated", maxPreemptions: intPtr(0), want: 0},
+		{name: "configured", maxPreemptions: intPtr(5), want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RunnerConfig{MaxPreemptions: tt.maxPreemptions}
+			if got := r.PreemptionLimit(); got != tt.want {
+				t.Errorf("PreemptionLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestCreateMachineInstanceResource(t *testing.T) {
+	api := newFakeComputeAPI(t)
+
+	tests := []struct {
+		name      string
+		configure func(r *RunnerConfig)
+		check     func(t *testing.T, instance *computepb.Instance)
+	}{
+		{
+			name:      "defaults",
+			configure: func(r *RunnerConfig) {},
+			check: func(t *testing.T, instance *computepb.Instance) {
+				disks := instance.GetDisks()
+				if len(disks) != 1 || disks[0].GetInitializeParams().GetDiskSizeGb() != 10 || !disks[0].GetBoot() {
+					t.Errorf("disks = %v, want the single 10GB boot disk", disks)
+				}
+				if got := instance.GetNetworkInterfaces()[0].GetAccessConfigs(); len(got) != 1 {
+					t.Errorf("access configs = %v, want the external NAT", got)
+				}
+				if instance.ServiceAccounts != nil || instance.ShieldedInstanceConfig != nil || instance.Tags != nil {
+					t.Errorf("unset options are set on the instance: %v", instance)
+				}
+			},
+		},
+		{
+			name: "disks",
+			configure: func(r *RunnerConfig) {
+				r.BootDiskSize = proto.Int64(50)
+				r.BootDiskType = proto.String("pd-ssd")
+				r.LocalSSDs = intPtr(2)
+			},
+			check: func(t *testing.T, instance *computepb.Instance) {
+				disks := instance.GetDisks()
+				if len(disks) != 3 {
+					t.Fatalf("got %d disk(s), want the boot disk and 2 local SSDs", len(disks))
+				}
+				boot := disks[0].GetInitializeParams()
+				if boot.GetDiskSizeGb() != 50 || boot.GetDiskType() != "zones/test-zone/diskTypes/pd-ssd" {
+					t.Errorf("boot disk = %v, want the 50GB pd-ssd", boot)
+				}
+				for _, ssd := range disks[1:] {
+					if ssd.GetType() != computepb.AttachedDisk_SCRATCH.String() || ssd.GetInterface() != computepb.AttachedDisk_NVME.String() {
+						t.Errorf("local SSD = %v, want the NVMe scratch disk", ssd)
+					}
+				}
+			},
+		},
+		{
+			name: "labels and network tags",
+			configure: func(r *RunnerConfig) {
+				r.Labels = map[string]string{"team": "ci"}
+				r.NetworkTags = []string{"runner", "allow-ssh"}
+			},
+			check: func(t *testing.T, instance *computepb.Instance) {
+				if want := map[string]string{"team": "ci"}; !reflect.DeepEqual(instance.GetLabels(), want) {
+					t.Errorf("labels = %v, want %v", instance.GetLabels(), want)
+				}
+				if want := []string{"runner", "allow-ssh"}; !reflect.DeepEqual(instance.GetTags().GetItems(), want) {
+					t.Errorf("tags = %v, want %v", instance.GetTags().GetItems(), want)
+				}
+			},
+		},
+		{
+			name: "private subnetwork",
+			configure: func(r *RunnerConfig) {
+				r.NetworkName = proto.String("runners")
+				r.Subnetwork = proto.String("regions/test-region/subnetworks/private")
+				r.PublicIP = proto.Bool(false)
+			},
+			check: func(t *testing.T, instance *computepb.Instance) {
+				networkInterface := instance.GetNetworkInterfaces()[0]
+				if networkInterface.GetName() != "runners" || networkInterface.GetSubnetwork() != "regions/test-region/subnetworks/private" {
+					t.Errorf("network interface = %v, want the private subnetwork of the runners network", networkInterface)
+				}
+				if len(networkInterface.GetAccessConfigs()) != 0 {
+					t.Errorf("private only instance has the access configs: %v", networkInterface.GetAccessConfigs())
+				}
+			},
+		},
+		{
+			name: "service account with the default scope",
+			configure: func(r *RunnerConfig) {
+				r.ServiceAccount = &ServiceAccountConfig{Email: "runner@test-project.iam.gserviceaccount.com"}
+			},
+			check: func(t *testing.T, instance *computepb.Instance) {
+				want := []*computepb.ServiceAccount{{
+					Email:  proto.String("runner@test-project.iam.gserviceaccount.com"),
+					Scopes: []string{"https://www.googleapis.com/auth/cloud-platform"},
+				}}
+				if !serviceAccountsEqual(instance.GetServiceAccounts(), want) {
+					t.Errorf("service accounts = %v, want %v", instance.GetServiceAccounts(), want)
+				}
+			},
+		},
+		{
+			name: "service account with the scopes",
+			configure: func(r *RunnerConfig) {
+				r.ServiceAccount = &ServiceAccountConfig{
+					Email:  "runner@test-project.iam.gserviceaccount.com",
+					Scopes: []string{"https://www.googleapis.com/auth/devstorage.read_only"},
+				}
+			},
+			check: func(t *testing.T, instance *computepb.Instance) {
+				want := []*computepb.ServiceAccount{{
+					Email:  proto.String("runner@test-project.iam.gserviceaccount.com"),
+					Scopes: []string{"https://www.googleapis.com/auth/devstorage.read_only"},
+				}}
+				if !serviceAccountsEqual(instance.GetServiceAccounts(), want) {
+					t.Errorf("service accounts = %v, want %v", instance.GetServiceAccounts(), want)
+				}
+			},
+		},
+		{
+			name: "shielded VM and min CPU platform",
+			configure: func(r *RunnerConfig) {
+				r.ShieldedVM = &ShieldedVMConfig{SecureBoot: proto.Bool(true), VTPM: proto.Bool(true), IntegrityMonitoring: proto.Bool(false)}
+				r.MinCPUPlatform = proto.String("Intel Cascade Lake")
+			},
+			check: func(t *testing.T, instance *computepb.Instance) {
+				want := &computepb.ShieldedInstanceConfig{
+					EnableSecureBoot:          proto.Bool(true),
+					EnableVtpm:                proto.Bool(true),
+					EnableIntegrityMonitoring: proto.Bool(false),
+				}
+				if !proto.Equal(instance.GetShieldedInstanceConfig(), want) {
+					t.Errorf("shielded instance config = %v, want %v", instance.GetShieldedInstanceConfig(), want)
+				}
+				if got := instance.GetMinCpuPlatform(); got != "Intel Cascade Lake" {
+					t.Errorf("min CPU platform = %q, want %q", got, "Intel Cascade Lake")
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRunnerConfig()
+			tt.configure(r)
+			tt.check(t, insertedInstance(t, api, r))
+		})
+	}
+}
+
+func serviceAccountsEqual(a, b []*computepb.ServiceAccount) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !proto.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDestroyMachine(t *testing.T) {
+	defer func(interval time.Duration) { machineAbsentPollInterval = interval }(machineAbsentPollInterval)
+	machineAbsentPollInterval = time.Millisecond * 10
+
+	tests := []struct {
+		name      string
+		configure func(api *fakeComputeAPI, r *RunnerConfig)
+		absent    bool
+		// wantLookups how many times the instance is looked up to confirm it is gone
+		wantLookups int
+		wantErr     string
+		wantCode    string
+	}{
+		{
+			name:        "deleted",
+			configure:   func(api *fakeComputeAPI, r *RunnerConfig) {},
+			wantLookups: 1,
+		},
+		{
+			name:      "already gone",
+			configure: func(api *fakeComputeAPI, r *RunnerConfig) {},
+			absent:    true,
+		},
+		{
+			name: "operation error",
+			configure: func(api *fakeComputeAPI, r *RunnerConfig) {
+				api.operationErrors["test-zone"] = "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE"
+			},
+			wantCode: "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE",
+		},
+		{
+			name: "operation timeout",
+			configure: func(api *fakeComputeAPI, r *RunnerConfig) {
+				api.pendingOperations = true
+				timeout := time.Millisecond * 50
+				r.OperationTimeout = &timeout
+			},
+			wantErr: "was not done after",
+		},
+		{
+			name: "absence is confirmed",
+			configure: func(api *fakeComputeAPI, r *RunnerConfig) {
+				api.lingering["runner-1"] = 2
+			},
+			wantLookups: 3,
+		},
+		{
+			name: "instance still exists",
+			configure: func(api *fakeComputeAPI, r *RunnerConfig) {
+				api.lingering["runner-1"] = -1
+				timeout := time.Millisecond * 50
+				r.OperationTimeout = &timeout
+			},
+			wantErr: "still exists",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeComputeAPI(t)
+			if !tt.absent {
+				api.instances["runner-1"] = true
+			}
+			r := testRunnerConfig()
+			tt.configure(api, r)
+
+			err := r.destroyMachine(context.Background(), "runner-1")
+			switch {
+			case tt.wantCode != "":
+				var opErr *OperationError
+				if !errors.As(err, &opErr) || !opErr.HasCode(tt.wantCode) {
+					t.Fatalf("destroyMachine() error = %v, want the operation error %s", err, tt.wantCode)
+				}
+				return
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("destroyMachine() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("destroyMachine() unexpected error: %v", err)
+			}
+
+			api.mu.Lock()
+			defer api.mu.Unlock()
+			if api.instances["runner-1"] {
+				t.Error("instance is left behind")
+			}
+			if api.lookups != tt.wantLookups {
+				t.Errorf("instance was looked up %d time(s), want %d", api.lookups, tt.wantLookups)
+			}
+		})
+	}
+}
@@ -3,12 +3,18 @@ package gcp
 import (
 	"context"
 	"github.com/76creates/runner-cli/log"
+	"github.com/76creates/runner-cli/provider"
 	"github.com/google/uuid"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"google.golang.org/protobuf/proto"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type Provider struct{}
 
-func (r RunnerConfig) CreateInstance(ctx context.Context, runnerInstanceName string) error {
+func (r *RunnerConfig) CreateInstance(ctx context.Context, runnerInstanceName string) error {
 	// generate unique ID, this will be used to tag the runner so we can
 	// have a easier time looking it up, and knowing if it initialized
 	runnerID := uuid.New().String()
@@ -18,23 +24,17 @@ func (r RunnerConfig) CreateInstance(ctx context.Context, runnerInstanceName str
 		return err
 	}
 
-	op, err := r.createMachine(ctx, runnerInstanceName, cloudInit)
+	err = r.createInZones(ctx, runnerInstanceName, cloudInit)
 	if err != nil {
 		return err
 	}
 
-	log.Debug("waiting for the operation to finish")
-	err = r.waitForComputeOP(ctx, op)
-	if err != nil {
-		return err
-	}
-
-	log.DebugF("successfully created instance with the name '%q'", runnerInstanceName)
+	log.DebugF("successfully created instance with the name '%q' in the zone %q", runnerInstanceName, r.instanceZone())
 
 	return nil
 }
 
-func (r RunnerConfig) DestroyInstance(ctx context.Context, runnerInstanceName string) error {
+func (r *RunnerConfig) DestroyInstance(ctx context.Context, runnerInstanceName string) error {
 	err := r.destroyMachine(ctx, runnerInstanceName)
 	if err != nil {
 		log.ErrorF("failed destroyed an instance with the name %q", runnerInstanceName)
@@ -44,6 +44,82 @@ func (r RunnerConfig) DestroyInstance(ctx context.Context, runnerInstanceName st
 	return nil
 }
 
-func (r RunnerConfig) InstanceStatus(ctx context.Context, runnerInstanceName string) error {
+func (r *RunnerConfig) PlanInstance(ctx context.Context, runnerInstanceName string) (*provider.InstancePlan, error) {
+	cloudInit, err := r.parseCloudData(ctx, runnerInstanceName, uuid.New().String())
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &provider.InstancePlan{Provider: "gcp", UserData: cloudInit}
+	plan.WithSpec("project", r.Project)
+	plan.WithSpec("zone", r.Zone)
+	if len(r.Zones) > 0 {
+		plan.WithSpec("zones", proto.String(strings.Join(r.Zones, ",")))
+	}
+	plan.WithSpec("region", r.Region)
+	plan.WithSpec("placement-strategy", proto.String(r.GetPlacementStrategy()))
+	plan.WithSpec("instance-template", r.InstanceTemplate)
+	plan.WithSpec("managed-instance-group", r.ManagedInstanceGroup)
+	plan.WithSpec("machine-type", r.MachineType)
+	plan.WithSpec("image", r.Image)
+	plan.WithSpec("network-name", r.NetworkName)
+	plan.WithSpec("subnetwork", r.Subnetwork)
+	plan.WithSpec("public-ip", proto.String(strconv.FormatBool(r.HasPublicIP())))
+	plan.WithSpec("boot-disk-type", r.BootDiskType)
+	if r.BootDiskSize != nil {
+		plan.WithSpec("boot-disk-size", proto.String(strconv.FormatInt(*r.BootDiskSize, 10)))
+	}
+	if r.LocalSSDs != nil {
+		plan.WithSpec("local-ssds", proto.String(strconv.Itoa(*r.LocalSSDs)))
+	}
+	if len(r.Labels) > 0 {
+		labels := make([]string, 0, len(r.Labels))
+		for k, v := range r.Labels {
+			labels = append(labels, k+"="+v)
+		}
+		sort.Strings(labels)
+		plan.WithSpec("labels", proto.String(strings.Join(labels, ",")))
+	}
+	if len(r.NetworkTags) > 0 {
+		plan.WithSpec("network-tags", proto.String(strings.Join(r.NetworkTags, ",")))
+	}
+	if r.ServiceAccount != nil {
+		plan.WithSpec("service-account", proto.String(r.ServiceAccount.Email))
+	}
+	plan.WithSpec("min-cpu-platform", r.MinCPUPlatform)
+	plan.WithSpec("provisioning-model", proto.String(r.GetProvisioningModel()))
+	return plan, nil
+}
+
+// Clone returns a copy of the config so per job values can be set on it
+func (r *RunnerConfig) Clone() provider.Provider {
+	c := *r
+	c.Runner = r.Runner.Clone()
+	return &c
+}
+
+// InstanceStatus returns InstancePreempted if the spot instance was preempted, standard instances
+// are not checked
+func (r *RunnerConfig) InstanceStatus(ctx context.Context, runnerInstanceName string) error {
+	if r.GetProvisioningModel() != ProvisioningModelSpot {
+		return nil
+	}
+
+	status, err := r.instanceStatus(ctx, runnerInstanceName)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case computepb.Instance_RUNNING.String(), computepb.Instance_PROVISIONING.String(), computepb.Instance_STAGING.String():
+		return nil
+	}
+
+	preempted, err := r.instancePreempted(ctx, runnerInstanceName)
+	if err != nil {
+		return err
+	}
+	if preempted {
+		return &provider.InstancePreempted{Name: runnerInstanceName}
+	}
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,206 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/76creates/runner-cli/log"
+	"google.golang.org/api/googleapi"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"math/rand"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PlacementOrdered zones are tried in the order they are listed, this is the default
+	PlacementOrdered = "ordered"
+	// PlacementRoundRobin first zone tried rotates with every instance of the runner type
+	PlacementRoundRobin = "round-robin"
+	// PlacementRandom zones are tried in a random order
+	PlacementRandom = "random"
+)
+
+// capacityErrorCodes are the operation error codes after which the next zone is tried
+var capacityErrorCodes = []string{
+	"ZONE_RESOURCE_POOL_EXHAUSTED",
+	"ZONE_RESOURCE_POOL_EXHAUSTED_WITH_DETAILS",
+	"QUOTA_EXCEEDED",
+	"RESOURCE_POOL_EXHAUSTED",
+	"STOCKOUT",
+}
+
+var (
+	// roundRobin holds the next zone index per runner type
+	roundRobin = make(map[string]int)
+	roundRobinMutex sync.Mutex
+
+	random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	randomMutex sync.Mutex
+)
+
+// instanceZone returns the zone the instance was placed in, configured zone before the placement
+func (r *RunnerConfig) instanceZone() string {
+	if r.zone != "" {
+		return r.zone
+	}
+	if r.Zone != nil {
+		return *r.Zone
+	}
+	if len(r.Zones) > 0 {
+		return r.Zones[0]
+	}
+	return ""
+}
+
+// candidateZones returns the zones to try ordered by the placement strategy, managed instance group
+// is bound to its zone so only it is returned in that case
+func (r *RunnerConfig) candidateZones(ctx context.Context) ([]string, error) {
+	var zones []string
+	switch {
+	case r.ManagedInstanceGroup != nil || r.Zone != nil:
+		if r.Zone == nil {
+			return nil, errors.New("zone must be set for the managed instance group")
+		}
+		return []string{*r.Zone}, nil
+	case len(r.Zones) > 0:
+		zones = append(zones, r.Zones...)
+	case r.Region != nil:
+		regionZones, err := r.regionZones(ctx)
+		if err != nil {
+			return nil, err
+		}
+		zones = regionZones
+	default:
+		return nil, errors.New("one of zone, zones or region must be set")
+	}
+
+	switch r.GetPlacementStrategy() {
+	case PlacementOrdered:
+	case PlacementRoundRobin:
+		roundRobinMutex.Lock()
+		next := roundRobin[r.RunnerType] % len(zones)
+		roundRobin[r.RunnerType] = next + 1
+		roundRobinMutex.Unlock()
+		zones = append(zones[next:], zones[:next]...)
+	case PlacementRandom:
+		randomMutex.Lock()
+		random.Shuffle(len(zones), func(i, j int) { zones[i], zones[j] = zones[j], zones[i] })
+		randomMutex.Unlock()
+	default:
+		return nil, fmt.Errorf("unknown placement strategy %q, expected ordered, round-robin or random", r.GetPlacementStrategy())
+	}
+	return zones, nil
+}
+
+// regionZones returns the zones of the region sorted by the name
+func (r *RunnerConfig) regionZones(ctx context.Context) ([]string, error) {
+	clientRegion, err := r.regionsClient()
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := clientRegion.Get(ctx, &computepb.GetRegionRequest{Project: *r.Project, Region: *r.Region})
+	if err != nil {
+		return nil, err
+	}
+
+	var zones []string
+	for _, zoneURL := range region.GetZones() {
+		zones = append(zones, path.Base(zoneURL))
+	}
+	sort.Strings(zones)
+	if len(zones) == 0 {
+		return nil, fmt.Errorf("region %q has no zones", *r.Region)
+	}
+	return zones, nil
+}
+
+// isCapacityError tells if the instance could not be created due to the stockout or the quota,
+// such errors are worth retrying in the next zone
+func isCapacityError(err error) bool {
+	var opErr *OperationError
+	if errors.As(err, &opErr) {
+		for _, code := range capacityErrorCodes {
+			if opErr.HasCode(code) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		for _, code := range capacityErrorCodes {
+			if strings.Contains(apiErr.Error(), code) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OperationError holds the errors the compute operation finished with
+type OperationError struct {
+	operation string
+	errors []*computepb.Errors
+}
+
+func (e *OperationError) Error() string {
+	var messages []string
+	for _, opErr := range e.errors {
+		messages = append(messages, fmt.Sprintf("%s: %s", opErr.GetCode(), opErr.GetMessage()))
+	}
+	return fmt.Sprintf("[ OperationError ] operation %q failed: %s", e.operation, strings.Join(messages, "; "))
+}
+
+// HasCode tells if the operation failed with the error code
+func (e *OperationError) HasCode(code string) bool {
+	for _, opErr := range e.errors {
+		if opErr.GetCode() == code {
+			return true
+		}
+	}
+	return false
+}
+
+// createInZones tries creating the instance zone by zone until it succeeds, zone the instance ended
+// up in is recorded so it is deleted from the right one
+func (r *RunnerConfig) createInZones(ctx context.Context, runnerInstanceName string, cloudInit *string) error {
+	zones, err := r.candidateZones(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, zone := range zones {
+		r.zone = zone
+		log.DebugF("creating the instance %q in the zone %q", runnerInstanceName, zone)
+
+		op, err := r.createMachine(ctx, runnerInstanceName, cloudInit)
+		if err == nil {
+			log.Debug("waiting for the operation to finish")
+			err = r.waitForComputeOP(ctx, op)
+		}
+		if err == nil && r.ManagedInstanceGroup != nil {
+			err = r.waitForGroupMachine(ctx, op, runnerInstanceName)
+		}
+		if err == nil {
+			return nil
+		}
+		if !isCapacityError(err) {
+			return err
+		}
+		if r.ManagedInstanceGroup != nil {
+			// group would keep retrying the create in this zone
+			if destroyErr := r.destroyMachine(ctx, runnerInstanceName); destroyErr != nil {
+				log.WarningF("could not remove the instance %q from the managed instance group in the zone %q: %s", runnerInstanceName, zone, destroyErr.Error())
+			}
+		}
+		log.WarningF("no capacity for the instance %q in the zone %q: %s", runnerInstanceName, zone, err.Error())
+	}
+
+	return fmt.Errorf("no capacity for the instance %q in any of the zones %s", runnerInstanceName, strings.Join(zones, ", "))
+}
@@ -0,0 +1,247 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCandidateZones(t *testing.T) {
+	api := newFakeComputeAPI(t)
+	api.regionZones = []string{"test-region-c", "test-region-a", "test-region-b"}
+
+	tests := []struct {
+		name      string
+		configure func(r *RunnerConfig)
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "zone",
+			configure: func(r *RunnerConfig) { r.Zones = []string{"ignored"} },
+			want:      []string{"test-zone"},
+		},
+		{
+			name: "managed instance group is bound to its zone",
+			configure: func(r *RunnerConfig) {
+				r.ManagedInstanceGroup = proto.String("runners")
+				r.PlacementStrategy = proto.String(PlacementRandom)
+			},
+			want: []string{"test-zone"},
+		},
+		{
+			name: "managed instance group without the zone",
+			configure: func(r *RunnerConfig) {
+				r.Zone = nil
+				r.Zones = []string{"zone-a", "zone-b"}
+				r.ManagedInstanceGroup = proto.String("runners")
+			},
+			wantErr: true,
+		},
+		{
+			name: "zones are ordered as listed",
+			configure: func(r *RunnerConfig) {
+				r.Zone = nil
+				r.Zones = []string{"zone-b", "zone-a", "zone-c"}
+			},
+			want: []string{"zone-b", "zone-a", "zone-c"},
+		},
+		{
+			name: "region zones are sorted by the name",
+			configure: func(r *RunnerConfig) {
+				r.Zone = nil
+				r.Region = proto.String("test-region")
+			},
+			want: []string{"test-region-a", "test-region-b", "test-region-c"},
+		},
+		{
+			name: "zones take precedence over the region",
+			configure: func(r *RunnerConfig) {
+				r.Zone = nil
+				r.Zones = []string{"zone-a"}
+				r.Region = proto.String("test-region")
+			},
+			want: []string{"zone-a"},
+		},
+		{
+			name:      "no zone",
+			configure: func(r *RunnerConfig) { r.Zone = nil },
+			wantErr:   true,
+		},
+		{
+			name: "unknown strategy",
+			configure: func(r *RunnerConfig) {
+				r.Zone = nil
+				r.Zones = []string{"zone-a"}
+				r.PlacementStrategy = proto.String("spread")
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRunnerConfig()
+			tt.configure(r)
+			got, err := r.candidateZones(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("candidateZones() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("candidateZones() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCandidateZonesRoundRobin(t *testing.T) {
+	zones := []string{"zone-a", "zone-b", "zone-c"}
+	candidates := func(runnerType string) []string {
+		r := &RunnerConfig{Zones: zones, PlacementStrategy: proto.String(PlacementRoundRobin)}
+		r.WithRunnerType(runnerType)
+		got, err := r.candidateZones(context.Background())
+		if err != nil {
+			t.Fatalf("candidateZones() unexpected error: %v", err)
+		}
+		return got
+	}
+
+	for i, want := range [][]string{
+		{"zone-a", "zone-b", "zone-c"},
+		{"zone-b", "zone-c", "zone-a"},
+		{"zone-c", "zone-a", "zone-b"},
+		{"zone-a", "zone-b", "zone-c"},
+	} {
+		if got := candidates("round-robin-test"); !reflect.DeepEqual(got, want) {
+			t.Errorf("instance %d candidateZones() = %v, want %v", i, got, want)
+		}
+	}
+	if got := candidates("round-robin-other"); !reflect.DeepEqual(got, zones) {
+		t.Errorf("other runner type starts with %v, want its own rotation %v", got, zones)
+	}
+	if !reflect.DeepEqual(zones, []string{"zone-a", "zone-b", "zone-c"}) {
+		t.Errorf("rotation reordered the configured zones: %v", zones)
+	}
+}
+
+func TestCandidateZonesRandom(t *testing.T) {
+	r := &RunnerConfig{Zones: []string{"zone-a", "zone-b", "zone-c"}, PlacementStrategy: proto.String(PlacementRandom)}
+	got, err := r.candidateZones(context.Background())
+	if err != nil {
+		t.Fatalf("candidateZones() unexpected error: %v", err)
+	}
+	sort.Strings(got)
+	if want := []string{"zone-a", "zone-b", "zone-c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("candidateZones() = %v, want every zone once", got)
+	}
+}
+
+func TestIsCapacityError(t *testing.T) {
+	operationError := func(codes ...string) *OperationError {
+		opErr := &OperationError{operation: "operation"}
+		for _, code := range codes {
+			opErr.errors = append(opErr.errors, &computepb.Errors{Code: proto.String(code), Message: proto.String("failed")})
+		}
+		return opErr
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "stockout", err: operationError("ZONE_RESOURCE_POOL_EXHAUSTED"), want: true},
+		{name: "stockout with details", err: operationError("ZONE_RESOURCE_POOL_EXHAUSTED_WITH_DETAILS"), want: true},
+		{name: "quota", err: operationError("QUOTA_EXCEEDED"), want: true},
+		{name: "one of the codes", err: operationError("UNSUPPORTED_OPERATION", "STOCKOUT"), want: true},
+		{name: "wrapped", err: fmt.Errorf("create: %w", operationError("RESOURCE_POOL_EXHAUSTED")), want: true},
+		{name: "other operation error", err: operationError("PERMISSION_DENIED")},
+		{
+			name: "api quota error",
+			err:  &googleapi.Error{Code: 403, Message: "Quota 'CPUS' exceeded", Errors: []googleapi.ErrorItem{{Reason: "QUOTA_EXCEEDED"}}},
+			want: true,
+		},
+		{name: "other api error", err: &googleapi.Error{Code: 400, Message: "Invalid value for field 'resource.machineType'"}},
+		{name: "plain error", err: errors.New("ZONE_RESOURCE_POOL_EXHAUSTED")},
+		{name: "no error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCapacityError(tt.err); got != tt.want {
+				t.Errorf("isCapacityError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateInZones(t *testing.T) {
+	tests := []struct {
+		name            string
+		operationErrors map[string]string
+		wantZones       []string
+		wantZone        string
+		wantErr         bool
+	}{
+		{
+			name:      "first zone",
+			wantZones: []string{"zone-a"},
+			wantZone:  "zone-a",
+		},
+		{
+			name:            "next zone after the stockout",
+			operationErrors: map[string]string{"zone-a": "ZONE_RESOURCE_POOL_EXHAUSTED"},
+			wantZones:       []string{"zone-a", "zone-b"},
+			wantZone:        "zone-b",
+		},
+		{
+			name:            "next zone after the quota",
+			operationErrors: map[string]string{"zone-a": "QUOTA_EXCEEDED", "zone-b": "STOCKOUT"},
+			wantZones:       []string{"zone-a", "zone-b", "zone-c"},
+			wantZone:        "zone-c",
+		},
+		{
+			name: "no capacity in any zone",
+			operationErrors: map[string]string{
+				"zone-a": "ZONE_RESOURCE_POOL_EXHAUSTED",
+				"zone-b": "ZONE_RESOURCE_POOL_EXHAUSTED",
+				"zone-c": "QUOTA_EXCEEDED",
+			},
+			wantZones: []string{"zone-a", "zone-b", "zone-c"},
+			wantErr:   true,
+		},
+		{
+			name:            "other error is not retried",
+			operationErrors: map[string]string{"zone-a": "PERMISSION_DENIED"},
+			wantZones:       []string{"zone-a"},
+			wantErr:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeComputeAPI(t)
+			for zone, code := range tt.operationErrors {
+				api.operationErrors[zone] = code
+			}
+
+			r := testRunnerConfig()
+			r.Zone = nil
+			r.Zones = []string{"zone-a", "zone-b", "zone-c"}
+			err := r.createInZones(context.Background(), "runner-1", proto.String("user data"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createInZones() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(api.insertZones, tt.wantZones) {
+				t.Errorf("instance was inserted in the zones %v, want %v", api.insertZones, tt.wantZones)
+			}
+			if !tt.wantErr && r.instanceZone() != tt.wantZone {
+				t.Errorf("instance zone = %q, want %q", r.instanceZone(), tt.wantZone)
+			}
+		})
+	}
+}
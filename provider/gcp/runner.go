@@ -1,24 +1,185 @@
 package gcp
 
-import "github.com/76creates/runner-cli/provider"
+import (
+	"errors"
+	"fmt"
+	"github.com/76creates/runner-cli/provider"
+	"github.com/76creates/runner-cli/secret"
+	"strings"
+	"time"
+)
 
 // RunnerConfig configuration for the runner runner creation, it contains access/credentials for the
 // given provider thus you can use multiple keys/accounts for multiple different runner types
 type RunnerConfig struct {
 	provider.BaseProvider
+	provider.CloudInitConfig `mapstructure:",squash" yaml:",inline"`
 
 	Access *AccessConfig `mapstructure:"access" yaml:"access"`
 
 	Zone *string `mapstructure:"zone" yaml:"zone"`
+	// Zones the instance can be placed in, tried according to the placement strategy until one has
+	// the capacity, used when the zone is not set
+	Zones []string `mapstructure:"zones" yaml:"zones"`
+	// Region all its zones are used as zones if neither zone nor zones are set
+	Region *string `mapstructure:"region" yaml:"region"`
+	// PlacementStrategy ordered, round-robin or random, defaults to ordered
+	PlacementStrategy *string `mapstructure:"placement-strategy" yaml:"placement-strategy"`
 	Project *string `mapstructure:"project" yaml:"project"`
 	MachineType *string `mapstructure:"machine-type" yaml:"machine-type"`
 	NetworkName *string `mapstructure:"network-name" yaml:"network-name"`
 	Image *string `mapstructure:"image" yaml:"image"`
-	CloudInit *string `mapstructure:"cloud-init" yaml:"cloud-init"`
+
+	// InstanceTemplate name or self link of the instance template the instance is created from, only the
+	// name and the user data are set on the instance, properties below are ignored
+	InstanceTemplate *string `mapstructure:"instance-template" yaml:"instance-template"`
+	// ManagedInstanceGroup name of the zonal managed instance group the instance is created in, group
+	// is resized by creating and deleting the named instances, its template is used for the instance
+	ManagedInstanceGroup *string `mapstructure:"managed-instance-group" yaml:"managed-instance-group"`
+
+	// BootDiskSize in GB, defaults to 10
+	BootDiskSize *int64 `mapstructure:"boot-disk-size" yaml:"boot-disk-size"`
+	// BootDiskType e.g. pd-standard, pd-balanced or pd-ssd, zone default is used if empty
+	BootDiskType *string `mapstructure:"boot-disk-type" yaml:"boot-disk-type"`
+	// LocalSSDs number of the 375GB NVMe local SSDs attached as scratch disks
+	LocalSSDs *int `mapstructure:"local-ssds" yaml:"local-ssds"`
+	// Labels GCE labels set on the instance
+	Labels map[string]string `mapstructure:"labels" yaml:"labels"`
+	// NetworkTags network tags set on the instance, used by the firewall rules
+	NetworkTags []string `mapstructure:"network-tags" yaml:"network-tags"`
+	// Subnetwork name or self link of the subnetwork the instance is attached to
+	Subnetwork *string `mapstructure:"subnetwork" yaml:"subnetwork"`
+	// PublicIP adds the external NAT access config, defaults to true, set it to false for the private
+	// only instances that reach the internet through the Cloud NAT
+	PublicIP *bool `mapstructure:"public-ip" yaml:"public-ip"`
+	ServiceAccount *ServiceAccountConfig `mapstructure:"service-account" yaml:"service-account"`
+	ShieldedVM *ShieldedVMConfig `mapstructure:"shielded-vm" yaml:"shielded-vm"`
+	// MinCPUPlatform e.g. "Intel Cascade Lake"
+	MinCPUPlatform *string `mapstructure:"min-cpu-platform" yaml:"min-cpu-platform"`
+
+	// ProvisioningModel standard or spot, spot instances are deleted when preempted
+	ProvisioningModel *string `mapstructure:"provisioning-model" yaml:"provisioning-model"`
+	// MaxPreemptions how many times the spot instance is re-created after the preemption before
+	// falling back to the standard one, defaults to 2
+	MaxPreemptions *int `mapstructure:"max-preemptions" yaml:"max-preemptions"`
+
+	// OperationTimeout how long to wait for the create and delete operations, defaults to 5m
+	OperationTimeout *time.Duration `mapstructure:"operation-timeout" yaml:"operation-timeout"`
+
+	// zone the instance was placed in
+	zone string
+}
+
+// ServiceAccountConfig service account the instance runs as
+type ServiceAccountConfig struct {
+	Email string `mapstructure:"email" yaml:"email"`
+	// Scopes defaults to the cloud-platform scope
+	Scopes []string `mapstructure:"scopes" yaml:"scopes"`
+}
+
+// ShieldedVMConfig shielded VM options, image must support them
+type ShieldedVMConfig struct {
+	SecureBoot *bool `mapstructure:"secure-boot" yaml:"secure-boot"`
+	VTPM *bool `mapstructure:"vtpm" yaml:"vtpm"`
+	IntegrityMonitoring *bool `mapstructure:"integrity-monitoring" yaml:"integrity-monitoring"`
+}
+
+const (
+	ProvisioningModelStandard = "standard"
+	ProvisioningModelSpot = "spot"
+)
+
+// GetProvisioningModel returns the configured provisioning model, standard if not set
+func (r *RunnerConfig) GetProvisioningModel() string {
+	if r.ProvisioningModel == nil || *r.ProvisioningModel == "" {
+		return ProvisioningModelStandard
+	}
+	return strings.ToLower(*r.ProvisioningModel)
+}
+
+// PreemptionLimit how many preemptions are tolerated before falling back to the standard instances
+func (r *RunnerConfig) PreemptionLimit() int {
+	if r.MaxPreemptions == nil {
+		return 2
+	}
+	return *r.MaxPreemptions
 }
 
 // AccessConfig if needed provides access info for the provider to authentification, etc.
-// if "access method" is not needed for the provider this struct should be left empty
+// if "access method" is not needed for the provider this struct should be left empty,
+// one of the json key, key file or workload identity config can be set, if none is set the
+// application default credentials are used
 type AccessConfig struct {
-	JSON *string `mapstructure:"json-key" yaml:"json-key"`
-}
\ No newline at end of file
+	JSON *secret.Secret `mapstructure:"json-key" yaml:"json-key"`
+	// KeyFile path to the service account json key
+	KeyFile *string `mapstructure:"key-file" yaml:"key-file"`
+	// WorkloadIdentityConfig path to the workload identity federation credential config, e.g. the one
+	// generated for the GitHub OIDC provider so no key is needed when running inside the Actions
+	WorkloadIdentityConfig *string `mapstructure:"workload-identity-config" yaml:"workload-identity-config"`
+	// ImpersonateServiceAccount email of the service account impersonated with the credentials above
+	ImpersonateServiceAccount *string `mapstructure:"impersonate-service-account" yaml:"impersonate-service-account"`
+	// Delegates chain of the service accounts used to impersonate the target one
+	Delegates []string `mapstructure:"delegates" yaml:"delegates"`
+}
+
+// Validate checks only one credentials source is set
+func (a *AccessConfig) Validate() error {
+	set := 0
+	for _, isSet := range []bool{a.JSON != nil, a.KeyFile != nil, a.WorkloadIdentityConfig != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return errors.New("only one of json-key, key-file or workload-identity-config can be set")
+	}
+	return nil
+}
+// WithOnDemand switches the runner to the standard instances
+func (r *RunnerConfig) WithOnDemand() {
+	standard := ProvisioningModelStandard
+	r.ProvisioningModel = &standard
+}
+
+// HasPublicIP tells if the instance gets the external ip
+func (r *RunnerConfig) HasPublicIP() bool {
+	return r.PublicIP == nil || *r.PublicIP
+}
+
+// instanceTemplateURL returns the self link of the instance template, global template is assumed
+// when only the name is set
+func (r *RunnerConfig) instanceTemplateURL() string {
+	if strings.Contains(*r.InstanceTemplate, "/") {
+		return *r.InstanceTemplate
+	}
+	return fmt.Sprintf("projects/%s/global/instanceTemplates/%s", *r.Project, *r.InstanceTemplate)
+}
+
+// instanceTemplateRef returns the project and the name of the instance template
+func (r *RunnerConfig) instanceTemplateRef() (string, string) {
+	project := *r.Project
+	parts := strings.Split(strings.Trim(r.instanceTemplateURL(), "/"), "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] == "projects" {
+			project = parts[i+1]
+			break
+		}
+	}
+	return project, parts[len(parts)-1]
+}
+
+// GetPlacementStrategy returns the configured placement strategy, ordered if not set
+func (r *RunnerConfig) GetPlacementStrategy() string {
+	if r.PlacementStrategy == nil || *r.PlacementStrategy == "" {
+		return PlacementOrdered
+	}
+	return strings.ToLower(*r.PlacementStrategy)
+}
+
+// GetOperationTimeout returns the configured operation timeout, 5m if not set
+func (r *RunnerConfig) GetOperationTimeout() time.Duration {
+	if r.OperationTimeout == nil || *r.OperationTimeout <= 0 {
+		return time.Minute * 5
+	}
+	return *r.OperationTimeout
+}
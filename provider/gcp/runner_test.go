@@ -0,0 +1,106 @@
+package gcp
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/76creates/runner-cli/secret"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAccessConfigValidate(t *testing.T) {
+	jsonKey := secret.Secret(`{"type": "service_account"}`)
+	tests := []struct {
+		name    string
+		access  AccessConfig
+		wantErr bool
+	}{
+		{name: "application default credentials"},
+		{name: "json key", access: AccessConfig{JSON: &jsonKey}},
+		{name: "key file", access: AccessConfig{KeyFile: proto.String("/etc/gcp/key.json")}},
+		{name: "workload identity", access: AccessConfig{WorkloadIdentityConfig: proto.String("/etc/gcp/wif.json")}},
+		{
+			name:   "impersonation with a key file",
+			access: AccessConfig{KeyFile: proto.String("/etc/gcp/key.json"), ImpersonateServiceAccount: proto.String("runner@test-project.iam.gserviceaccount.com")},
+		},
+		{
+			name:    "json key and key file",
+			access:  AccessConfig{JSON: &jsonKey, KeyFile: proto.String("/etc/gcp/key.json")},
+			wantErr: true,
+		},
+		{
+			name:    "key file and workload identity",
+			access:  AccessConfig{KeyFile: proto.String("/etc/gcp/key.json"), WorkloadIdentityConfig: proto.String("/etc/gcp/wif.json")},
+			wantErr: true,
+		},
+		{
+			name:    "all of them",
+			access:  AccessConfig{JSON: &jsonKey, KeyFile: proto.String("/etc/gcp/key.json"), WorkloadIdentityConfig: proto.String("/etc/gcp/wif.json")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.access.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	jsonKey := secret.Secret(`{"type": "service_account"}`)
+	tests := []struct {
+		name    string
+		access  *AccessConfig
+		want    []option.ClientOption
+		wantErr string
+	}{
+		{name: "application default credentials without the access"},
+		{name: "application default credentials", access: &AccessConfig{}},
+		{
+			name:   "json key",
+			access: &AccessConfig{JSON: &jsonKey},
+			want:   []option.ClientOption{option.WithCredentialsJSON([]byte(jsonKey.Value()))},
+		},
+		{
+			name:   "key file",
+			access: &AccessConfig{KeyFile: proto.String("/etc/gcp/key.json")},
+			want:   []option.ClientOption{option.WithCredentialsFile("/etc/gcp/key.json")},
+		},
+		{
+			name:   "workload identity",
+			access: &AccessConfig{WorkloadIdentityConfig: proto.String("/etc/gcp/wif.json")},
+			want:   []option.ClientOption{option.WithCredentialsFile("/etc/gcp/wif.json")},
+		},
+		{
+			name: "impersonation with the unusable credentials",
+			access: &AccessConfig{
+				KeyFile:                   proto.String("/nonexistent/key.json"),
+				ImpersonateServiceAccount: proto.String("runner@test-project.iam.gserviceaccount.com"),
+			},
+			wantErr: "could not impersonate",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RunnerConfig{Access: tt.access}
+			got, err := r.clientOptions(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("clientOptions() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("clientOptions() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clientOptions() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package provider
+
+// PlanRegistrationToken is used in place of the registration token when planning, no token is minted in that case
+const PlanRegistrationToken = "DRY-RUN-REGISTRATION-TOKEN"
+
+// PlanJITConfig is used in place of the just-in-time runner config when planning
+const PlanJITConfig = "DRY-RUN-JIT-CONFIG"
+
+// InstancePlan describes the instance that would be created by the provider
+type InstancePlan struct {
+	// Provider name of the provider type e.g. gcp
+	Provider string
+	// Spec holds the instance properties that are sent to the provider
+	Spec map[string]string
+	// UserData is the rendered user data, nil if there is none
+	UserData *string
+}
+
+// WithSpec sets the spec field if the value is not nil
+func (p *InstancePlan) WithSpec(name string, value *string) {
+	if value == nil {
+		return
+	}
+	if p.Spec == nil {
+		p.Spec = make(map[string]string)
+	}
+	p.Spec[name] = *value
+}
@@ -2,6 +2,8 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"github.com/76creates/runner-cli/secret"
 )
 
 type Provider interface {
@@ -11,13 +13,45 @@ type Provider interface {
 	CreateInstance(ctx context.Context, runnerInstanceName string) error
 	// DestroyInstance destroys the image but does not deregister the runner
 	DestroyInstance(ctx context.Context, runnerInstanceName string) error
-	// InstanceStatus returns the status of the instance
+	// InstanceStatus returns the status of the instance, nil if it is running, InstancePreempted if it
+	// was reclaimed by the provider
 	InstanceStatus(ctx context.Context, runnerInstanceName string) error
+	// PlanInstance describes the instance CreateInstance would create, it does not call the provider API
+	PlanInstance(ctx context.Context, runnerInstanceName string) (*InstancePlan, error)
 
 	// WantGithubRegistrationToken tells if provider needs a registration token
 	WantGithubRegistrationToken() bool
 	WithGithubRegistrationToken(token string)
+	// WithGithubJITConfig sets the encoded just-in-time runner config, used instead of the registration token
+	WithGithubJITConfig(jitConfig string)
+	// ReleaseGithubCredentials clears the registration token and the JIT config once the runner is gone
+	ReleaseGithubCredentials()
 	WithRunnerType(runnerType string)
+	// WithRunnerSpec sets the registration settings of the runner type
+	WithRunnerSpec(spec RunnerSpec)
+	// WithJob sets the job the runner is created for
+	WithJob(job JobInfo)
+	// Clone returns a copy of the provider so per job values can be set without affecting other jobs
+	Clone() Provider
+}
+
+// Preemptible is implemented by the providers that can create instances the cloud may reclaim at any
+// time, tend re-provisions the runner when the instance is preempted before picking up the job and
+// falls back to the on-demand instances after too many preemptions
+type Preemptible interface {
+	// PreemptionLimit how many preemptions are tolerated before falling back to the on-demand instances
+	PreemptionLimit() int
+	// WithOnDemand switches the provider to the on-demand instances
+	WithOnDemand()
+}
+
+// InstancePreempted is returned by the InstanceStatus when the instance was reclaimed by the provider
+type InstancePreempted struct {
+	Name string
+}
+
+func (e *InstancePreempted) Error() string {
+	return fmt.Sprintf("[ InstancePreempted ] instance %q was preempted", e.Name)
 }
 
 type providerInstanceStatus int
@@ -28,9 +62,51 @@ const (
 	providerInstanceStatusAbsent providerInstanceStatus = 2
 )
 
+// RunnerSpec holds the runner registration settings of the runner type
+type RunnerSpec struct {
+	Labels []string
+	Group string
+	Ephemeral bool
+	// Vars user defined template variables
+	Vars map[string]string
+}
+
+// Clone returns a deep copy of the spec so the jobs do not share the labels and vars
+func (s RunnerSpec) Clone() RunnerSpec {
+	c := s
+	if s.Labels != nil {
+		c.Labels = append([]string{}, s.Labels...)
+	}
+	if s.Vars != nil {
+		c.Vars = make(map[string]string, len(s.Vars))
+		for k, v := range s.Vars {
+			c.Vars[k] = v
+		}
+	}
+	return c
+}
+
+// JobInfo describes the workflow job the runner is created for
+type JobInfo struct {
+	// Repository in the owner/name format
+	Repository string
+	// ServerURL of the GitHub server e.g. https://github.com
+	ServerURL string
+	// RegistrationURL runner registers with, repository or organisation url
+	RegistrationURL string
+	// CABundle PEM encoded CA bundle the runner should trust to reach the GitHub enterprise server
+	CABundle string
+	WorkflowRunID int64
+	JobID int64
+	JobName string
+}
+
 type BaseProvider struct {
 	GithubRegistrationToken string
+	GithubJITConfig string
 	RunnerType string
+	Runner RunnerSpec
+	Job JobInfo
 }
 
 // WithRunnerType sets runner type
@@ -38,10 +114,43 @@ func (b *BaseProvider)WithRunnerType(runnerType string) {
 	b.RunnerType = runnerType
 }
 
+// WithRunnerSpec sets the registration settings of the runner type
+func (b *BaseProvider)WithRunnerSpec(spec RunnerSpec) {
+	b.Runner = spec
+}
+
+// WithJob sets the job the runner is created for
+func (b *BaseProvider)WithJob(job JobInfo) {
+	b.Job = job
+}
+
 // WantGithubRegistrationToken tells if provider needs a registration token
 func (b *BaseProvider)WantGithubRegistrationToken() bool { return true }
 
-// WithGithubRegistrationToken sets registration token
+// WithGithubRegistrationToken sets registration token, token it replaces is no longer redacted,
+// the plan placeholder is not a secret so it is not redacted either
 func (b *BaseProvider)WithGithubRegistrationToken(token string) {
+	secret.Deregister(b.GithubRegistrationToken)
+	if token != PlanRegistrationToken {
+		secret.Register(token)
+	}
 	b.GithubRegistrationToken = token
 }
+
+// WithGithubJITConfig sets the encoded just-in-time runner config
+func (b *BaseProvider)WithGithubJITConfig(jitConfig string) {
+	secret.Deregister(b.GithubJITConfig)
+	if jitConfig != PlanJITConfig {
+		secret.Register(jitConfig)
+	}
+	b.GithubJITConfig = jitConfig
+}
+
+// ReleaseGithubCredentials clears the registration token and the JIT config and drops them from
+// the redaction, they are minted per runner so keeping them would grow the registry for as long as tend runs
+func (b *BaseProvider)ReleaseGithubCredentials() {
+	secret.Deregister(b.GithubRegistrationToken)
+	secret.Deregister(b.GithubJITConfig)
+	b.GithubRegistrationToken = ""
+	b.GithubJITConfig = ""
+}
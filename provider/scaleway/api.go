@@ -0,0 +1,157 @@
+package scaleway
+
+import (
+	"context"
+	"fmt"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// scaleway-sdk-go v1.0.0-beta.7 lacks some of the API used here and the later versions need a newer go,
+// requests below are built by hand and sent with the SDK client so the auth and the errors stay the same
+
+// listPerPage page size of the hand built list requests
+const listPerPage = 100
+
+// listTagged lists the zone resources of the scope tagged with the tag, page by page
+func (r *RunnerConfig) listTagged(ctx context.Context, client *scw.Client, resource, tag string, page int, resp interface{}) error {
+	query := url.Values{}
+	query.Set("tags", tag)
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(listPerPage))
+	organization, project := r.scope()
+	if organization != nil {
+		query.Set("organization", *organization)
+	}
+	if project != nil {
+		query.Set("project", *project)
+	}
+
+	req := &scw.ScalewayRequest{
+		Method:  http.MethodGet,
+		Path:    fmt.Sprintf("/instance/v1/zones/%s/%s", *r.Zone, resource),
+		Query:   query,
+		Headers: http.Header{},
+	}
+	return client.Do(req, resp, scw.WithContext(ctx))
+}
+
+// listTaggedIPs returns the flexible IPs tagged with the tag, SDK ListIPs can not filter by tags
+func (r *RunnerConfig) listTaggedIPs(ctx context.Context, client *scw.Client, tag string) ([]*instance.IP, error) {
+	var ips []*instance.IP
+	for page := 1; ; page++ {
+		var resp instance.ListIPsResponse
+		if err := r.listTagged(ctx, client, "ips", tag, page, &resp); err != nil {
+			return nil, err
+		}
+		ips = append(ips, resp.IPs...)
+		if len(resp.IPs) == 0 || len(ips) >= int(resp.TotalCount) {
+			return ips, nil
+		}
+	}
+}
+
+// listTaggedVolumes returns the volumes tagged with the tag, SDK ListVolumes can not filter by tags
+func (r *RunnerConfig) listTaggedVolumes(ctx context.Context, client *scw.Client, tag string) ([]*instance.Volume, error) {
+	var volumes []*instance.Volume
+	for page := 1; ; page++ {
+		var resp instance.ListVolumesResponse
+		if err := r.listTagged(ctx, client, "volumes", tag, page, &resp); err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, resp.Volumes...)
+		if len(resp.Volumes) == 0 || len(volumes) >= int(resp.TotalCount) {
+			return volumes, nil
+		}
+	}
+}
+
+// createRoutedIPv6 creates the routed IPv6 flexible IP attached to the server, SDK CreateIP has no IP type
+// and creates the IPv4 only
+func (r *RunnerConfig) createRoutedIPv6(ctx context.Context, client *scw.Client, name, serverID string) (*instance.IP, error) {
+	organization, project := r.scope()
+	body := map[string]interface{}{
+		"type":   "routed_ipv6",
+		"server": serverID,
+		"tags":   r.withRunnerNameTag(name),
+	}
+	if organization != nil {
+		body["organization"] = *organization
+	}
+	if project != nil {
+		body["project"] = *project
+	}
+
+	req := &scw.ScalewayRequest{
+		Method:  http.MethodPost,
+		Path:    fmt.Sprintf("/instance/v1/zones/%s/ips", *r.Zone),
+		Headers: http.Header{},
+	}
+	if err := req.SetBody(body); err != nil {
+		return nil, err
+	}
+	var resp instance.CreateIPResponse
+	if err := client.Do(req, &resp, scw.WithContext(ctx)); err != nil {
+		return nil, err
+	}
+	return resp.IP, nil
+}
+
+// enableRoutedIP switches the stopped server to the routed IPs, SDK CreateServer and UpdateServer
+// have no routed IP field
+func (r *RunnerConfig) enableRoutedIP(ctx context.Context, client *scw.Client, serverID string) error {
+	req := &scw.ScalewayRequest{
+		Method:  http.MethodPatch,
+		Path:    fmt.Sprintf("/instance/v1/zones/%s/servers/%s", *r.Zone, serverID),
+		Headers: http.Header{},
+	}
+	if err := req.SetBody(map[string]interface{}{"routed_ip_enabled": true}); err != nil {
+		return err
+	}
+	return client.Do(req, &instance.UpdateServerResponse{}, scw.WithContext(ctx))
+}
+
+// gatewayNetwork is the attachment of the public gateway to the private network
+type gatewayNetwork struct {
+	ID        string `json:"id"`
+	GatewayID string `json:"gateway_id"`
+	Status    string `json:"status"`
+}
+
+// listGatewayNetworks returns the public gateways attachments of the private network, SDK has no
+// public gateway API
+func (r *RunnerConfig) listGatewayNetworks(ctx context.Context, client *scw.Client, privateNetworkID string) ([]gatewayNetwork, error) {
+	query := url.Values{}
+	query.Set("private_network_id", privateNetworkID)
+	query.Set("per_page", strconv.Itoa(listPerPage))
+
+	req := &scw.ScalewayRequest{
+		Method:  http.MethodGet,
+		Path:    fmt.Sprintf("/vpc-gw/v1/zones/%s/gateway-networks", *r.Zone),
+		Query:   query,
+		Headers: http.Header{},
+	}
+	var resp struct {
+		GatewayNetworks []gatewayNetwork `json:"gateway_networks"`
+	}
+	if err := client.Do(req, &resp, scw.WithContext(ctx)); err != nil {
+		return nil, err
+	}
+	return resp.GatewayNetworks, nil
+}
+
+// tagVolume sets the tags on the volume, SDK UpdateVolume does not take tags
+func (r *RunnerConfig) tagVolume(ctx context.Context, client *scw.Client, volumeID string, tags []string) error {
+	req := &scw.ScalewayRequest{
+		Method:  http.MethodPatch,
+		Path:    fmt.Sprintf("/instance/v1/zones/%s/volumes/%s", *r.Zone, volumeID),
+		Headers: http.Header{},
+	}
+	if err := req.SetBody(map[string]interface{}{"tags": tags}); err != nil {
+		return err
+	}
+	return client.Do(req, &instance.UpdateVolumeResponse{}, scw.WithContext(ctx))
+}
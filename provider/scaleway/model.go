@@ -2,14 +2,19 @@ package scaleway
 
 import (
 	"context"
+	"io/ioutil"
+	"strings"
 
 	"github.com/76creates/runner-cli/log"
+	"github.com/76creates/runner-cli/provider"
 	"github.com/google/uuid"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
 )
 
 type Provider struct{}
 
-func (r RunnerConfig) CreateInstance(ctx context.Context, runnerInstanceName string) error {
+func (r *RunnerConfig) CreateInstance(ctx context.Context, runnerInstanceName string) error {
 	log.Debug("creating and running scaleway instance")
 
 	// generate unique ID, this will be used to tag the runner so we can
@@ -22,43 +27,96 @@ func (r RunnerConfig) CreateInstance(ctx context.Context, runnerInstanceName str
 		return err
 	}
 
+	if err = r.ValidateNetwork(); err != nil {
+		return err
+	}
+	r.warnNetwork()
+
 	c, err := r.getClient()
 	if err != nil {
 		return err
 	}
 
+	if r.PrivateNetwork != nil && r.GetPublicIP() != PublicIPv4 {
+		if err = r.verifyPublicGateway(ctx, c); err != nil {
+			return err
+		}
+	}
+
 	srv, err := r.createInstance(ctx, c, runnerInstanceName)
 	if err != nil {
 		log.Error("failed creating scaleway instance")
+		r.cleanupFailedCreate(ctx, c, runnerInstanceName, nil)
 		return err
 	}
 	log.DebugF("created server %q", srv.ID)
 
-	ip, err := r.attachPublicIPv4(ctx, c, srv.ID)
-	if err != nil {
-		log.ErrorF("failed attaching IP to the %q instance", srv.ID)
+	if err = r.tagVolumes(ctx, c, runnerInstanceName, srv); err != nil {
+		log.ErrorF("failed tagging the volumes of the %q instance", srv.ID)
+		r.cleanupFailedCreate(ctx, c, runnerInstanceName, srv)
 		return err
 	}
-	log.DebugF("attached IP %q to the server %q", ip.Address.String(), srv.ID)
+
+	if r.GetPublicIP() != PublicIPNone {
+		ip, err := r.attachPublicIP(ctx, c, runnerInstanceName, srv.ID)
+		if err != nil {
+			log.ErrorF("failed attaching IP to the %q instance", srv.ID)
+			r.cleanupFailedCreate(ctx, c, runnerInstanceName, srv)
+			return err
+		}
+		log.DebugF("attached IP %q to the server %q", ip.ID, srv.ID)
+	}
+
+	if r.PrivateNetwork != nil {
+		nic, err := r.attachPrivateNetwork(ctx, c, srv.ID)
+		if err != nil {
+			log.ErrorF("failed attaching private network to the %q instance", srv.ID)
+			r.cleanupFailedCreate(ctx, c, runnerInstanceName, srv)
+			return err
+		}
+		log.DebugF("attached private NIC %q to the server %q", nic.ID, srv.ID)
+	}
 
 	err = r.addCloudInit(ctx, c, srv.ID, cloudInit)
 	if err != nil {
 		log.ErrorF("failed adding user data to the %q instance", srv.ID)
+		r.cleanupFailedCreate(ctx, c, runnerInstanceName, srv)
 		return err
 	}
 
 	err = r.startServerAndWait(c, srv.ID)
 	if err != nil {
 		log.ErrorF("failed powering on the %q instance", srv.ID)
+		r.cleanupFailedCreate(ctx, c, runnerInstanceName, srv)
 		return err
 	}
 
-	log.DebugF("successfully created and ran scaleway instance %q with public IP %q", srv.ID, ip.Address.String())
+	log.DebugF("successfully created and ran scaleway instance %q with public IP mode %q", srv.ID, r.GetPublicIP())
 	return nil
 }
 
-func (r RunnerConfig) DestroyInstance(ctx context.Context, runnerInstanceName string) error {
-	// TODO: reserved IP is not getting deleted
+// cleanupFailedCreate releases whatever was created before the creation failed, server is looked up
+// by the name if the create call failed since it could still have been created
+func (r *RunnerConfig) cleanupFailedCreate(ctx context.Context, c *scw.Client, runnerInstanceName string, srv *instance.Server) {
+	log.DebugF("cleaning up after the failed creation of the %q instance", runnerInstanceName)
+	if srv == nil {
+		server, err := r.getServerByName(ctx, c, runnerInstanceName)
+		if err != nil {
+			log.ErrorF("failed looking up the %q instance for the cleanup: %s", runnerInstanceName, err.Error())
+			return
+		}
+		srv = server
+	} else if server, err := r.getServerByName(ctx, c, runnerInstanceName); err == nil && server != nil {
+		// refresh the server so its current state and volumes are known
+		srv = server
+	}
+
+	if err := r.releaseResources(ctx, c, runnerInstanceName, srv); err != nil {
+		log.ErrorF("failed cleaning up after the %q instance: %s", runnerInstanceName, err.Error())
+	}
+}
+
+func (r *RunnerConfig) DestroyInstance(ctx context.Context, runnerInstanceName string) error {
 	log.Debug("destroying scaleway instance")
 
 	c, err := r.getClient()
@@ -74,7 +132,8 @@ func (r RunnerConfig) DestroyInstance(ctx context.Context, runnerInstanceName st
 		log.WarningF("instance with name %q not found, assuming its already deleted", runnerInstanceName)
 	}
 
-	err = r.terminateInstance(c, server)
+	// IPs and volumes are released even if the server is gone already
+	err = r.releaseResources(ctx, c, runnerInstanceName, server)
 	if err != nil {
 		return err
 	}
@@ -83,6 +142,47 @@ func (r RunnerConfig) DestroyInstance(ctx context.Context, runnerInstanceName st
 	return nil
 }
 
-func (r RunnerConfig) InstanceStatus(ctx context.Context, runnerInstanceName string) error {
+func (r *RunnerConfig) PlanInstance(ctx context.Context, runnerInstanceName string) (*provider.InstancePlan, error) {
+	if err := r.ValidateNetwork(); err != nil {
+		return nil, err
+	}
+	r.warnNetwork()
+	cloudInit, err := r.parseCloudData(ctx, runnerInstanceName, uuid.New().String())
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &provider.InstancePlan{Provider: "scaleway"}
+	plan.WithSpec("zone", r.Zone)
+	plan.WithSpec("instance-type", r.InstanceType)
+	plan.WithSpec("image", r.Image)
+	plan.WithSpec("security-group", r.SecurityGroup)
+	publicIP := r.GetPublicIP()
+	plan.WithSpec("public-ip", &publicIP)
+	plan.WithSpec("private-network", r.PrivateNetwork)
+	plan.WithSpec("placement-group", r.PlacementGroup)
+	if r.Tags != nil {
+		tags := strings.Join(*r.Tags, ",")
+		plan.WithSpec("tags", &tags)
+	}
+	if cloudInit != nil {
+		content, err := ioutil.ReadAll(*cloudInit)
+		if err != nil {
+			return nil, err
+		}
+		userData := string(content)
+		plan.UserData = &userData
+	}
+	return plan, nil
+}
+
+// Clone returns a copy of the config so per job values can be set on it
+func (r *RunnerConfig) Clone() provider.Provider {
+	c := *r
+	c.Runner = r.Runner.Clone()
+	return &c
+}
+
+func (r *RunnerConfig) InstanceStatus(ctx context.Context, runnerInstanceName string) error {
 	return nil
 }
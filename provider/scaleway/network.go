@@ -0,0 +1,100 @@
+package scaleway
+
+import (
+	"context"
+	"fmt"
+	"github.com/76creates/runner-cli/log"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+	"strings"
+)
+
+const (
+	// PublicIPv4 instance gets the dynamic and the flexible IPv4, this is the default
+	PublicIPv4 = "ipv4"
+	// PublicIPv6 instance gets the routed IPv6 flexible IP only, IPv4 egress has to go through the public gateway
+	PublicIPv6 = "ipv6"
+	// PublicIPNone instance gets no public IP, all egress goes through the public gateway
+	PublicIPNone = "none"
+)
+
+// GetPublicIP returns the configured public IP mode, ipv4 if not set
+func (r *RunnerConfig) GetPublicIP() string {
+	if r.PublicIP == nil || *r.PublicIP == "" {
+		return PublicIPv4
+	}
+	return strings.ToLower(*r.PublicIP)
+}
+
+// ValidateNetwork checks the public IP mode is known and that the instance without the public IP
+// has the private network to reach GitHub through, it is called when the config is parsed
+func (r *RunnerConfig) ValidateNetwork() error {
+	switch r.GetPublicIP() {
+	case PublicIPv4, PublicIPv6:
+		return nil
+	case PublicIPNone:
+		if r.PrivateNetwork == nil {
+			return fmt.Errorf("instance without the public IP needs the private network with the public gateway for egress")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown public IP mode %q, expected ipv4, ipv6 or none", r.GetPublicIP())
+	}
+}
+
+// warnNetwork warns about the network the runner may not reach GitHub from, it is logged when the
+// instance is created or planned rather than on every parse of the config
+func (r *RunnerConfig) warnNetwork() {
+	// github.com is not reachable over IPv6, runner could still work with the IPv6 enabled enterprise server
+	if r.GetPublicIP() == PublicIPv6 && r.PrivateNetwork == nil {
+		log.Warning("IPv6 only instance has no private network, GitHub must be reachable over IPv6")
+	}
+}
+
+// verifyPublicGateway makes sure the private network has the public gateway attached, instance without
+// the public IPv4 has no IPv4 egress without it
+func (r *RunnerConfig) verifyPublicGateway(ctx context.Context, client *scw.Client) error {
+	gateways, err := r.listGatewayNetworks(ctx, client, *r.PrivateNetwork)
+	if err != nil {
+		return fmt.Errorf("could not look up the public gateway of the private network %q: %w", *r.PrivateNetwork, err)
+	}
+	if len(gateways) == 0 {
+		return fmt.Errorf("private network %q has no public gateway attached, instance with the public IP mode %q has no IPv4 egress without it", *r.PrivateNetwork, r.GetPublicIP())
+	}
+	log.DebugF("private network %q egress goes through the public gateway %q", *r.PrivateNetwork, gateways[0].GatewayID)
+	return nil
+}
+
+// attachPublicIP creates the flexible IP of the public IP mode attached to the server, routed IPv6
+// in the ipv6 mode and IPv4 otherwise, routed IP is enabled on the server first since it only
+// accepts the routed IPs then
+func (r *RunnerConfig) attachPublicIP(ctx context.Context, client *scw.Client, name, serverID string) (*instance.IP, error) {
+	if r.GetPublicIP() == PublicIPv6 {
+		log.Debug("enabling routed IP on the instance")
+		if err := r.enableRoutedIP(ctx, client, serverID); err != nil {
+			return nil, fmt.Errorf("could not enable routed IP on the server %q: %w", serverID, err)
+		}
+		log.Debug("attaching routed IPv6 to the instance")
+		return r.createRoutedIPv6(ctx, client, name, serverID)
+	}
+	return r.attachPublicIPv4(ctx, client, name, serverID)
+}
+
+// attachPrivateNetwork attaches the private NIC to the stopped instance, NIC is removed together with the
+// instance, addressing and the default route are pushed by the DHCP of the public gateway
+func (r *RunnerConfig) attachPrivateNetwork(ctx context.Context, client *scw.Client, serverID string) (*instance.PrivateNIC, error) {
+	log.DebugF("attaching private network %q to the instance", *r.PrivateNetwork)
+
+	api := instance.NewAPI(client)
+
+	resp, err := api.CreatePrivateNIC(&instance.CreatePrivateNICRequest{
+		Zone:             scw.Zone(*r.Zone),
+		ServerID:         serverID,
+		PrivateNetworkID: *r.PrivateNetwork,
+	}, scw.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.PrivateNic, nil
+}
@@ -0,0 +1,87 @@
+package scaleway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAttachPublicIPv6IsRouted(t *testing.T) {
+	var body, serverBody map[string]interface{}
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodPatch && req.URL.Path == "/instance/v1/zones/fr-par-1/servers/server":
+			if err := json.NewDecoder(req.Body).Decode(&serverBody); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, map[string]interface{}{"server": map[string]interface{}{"id": "server"}})
+		case req.Method == http.MethodPost && req.URL.Path == "/instance/v1/zones/fr-par-1/ips":
+			if serverBody == nil {
+				http.Error(w, "routed IP is not enabled on the server", http.StatusBadRequest)
+				return
+			}
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, map[string]interface{}{"ip": map[string]interface{}{"id": "ip-v6"}})
+		default:
+			http.Error(w, "unexpected request "+req.Method+" "+req.URL.Path, http.StatusNotImplemented)
+		}
+	}))
+
+	zone, project, mode := "fr-par-1", "project", PublicIPv6
+	r := &RunnerConfig{Zone: &zone, PublicIP: &mode, Access: &AccessConfig{ProjectID: &project}}
+	ip, err := r.attachPublicIP(context.Background(), client, "runner-1", "server")
+	if err != nil {
+		t.Fatalf("attachPublicIP() unexpected error: %v", err)
+	}
+	if ip.ID != "ip-v6" {
+		t.Errorf("attachPublicIP() = %q, want ip-v6", ip.ID)
+	}
+	if serverBody["routed_ip_enabled"] != true {
+		t.Errorf("update server request = %v, want the routed IP enabled", serverBody)
+	}
+	if body["type"] != "routed_ipv6" || body["server"] != "server" || body["project"] != "project" {
+		t.Errorf("create IP request = %v, want the routed IPv6 attached to the server", body)
+	}
+	tags, _ := body["tags"].([]interface{})
+	if len(tags) != 1 || tags[0] != runnerNameTag("runner-1") {
+		t.Errorf("create IP request tags = %v, want the runner name tag", body["tags"])
+	}
+}
+
+func TestVerifyPublicGateway(t *testing.T) {
+	tests := []struct {
+		name     string
+		gateways []map[string]interface{}
+		wantErr  string
+	}{
+		{name: "gateway attached", gateways: []map[string]interface{}{{"id": "gn-1", "gateway_id": "gw-1"}}},
+		{name: "no gateway", gateways: []map[string]interface{}{}, wantErr: "has no public gateway attached"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Path != "/vpc-gw/v1/zones/fr-par-1/gateway-networks" || req.URL.Query().Get("private_network_id") != "pn-1" {
+					http.Error(w, "unexpected request "+req.URL.String(), http.StatusNotImplemented)
+					return
+				}
+				writeJSON(w, map[string]interface{}{"gateway_networks": tt.gateways, "total_count": len(tt.gateways)})
+			}))
+
+			zone, network, mode := "fr-par-1", "pn-1", PublicIPNone
+			r := &RunnerConfig{Zone: &zone, PrivateNetwork: &network, PublicIP: &mode}
+			err := r.verifyPublicGateway(context.Background(), client)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("verifyPublicGateway() unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("verifyPublicGateway() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
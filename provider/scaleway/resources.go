@@ -0,0 +1,173 @@
+package scaleway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/76creates/runner-cli/log"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+	"strings"
+)
+
+// runnerNameTagPrefix is prefixed to the runner name and set as a tag on everything created for
+// the runner so it can be found and released when the runner is destroyed
+const runnerNameTagPrefix = "gh-runner-name="
+
+func runnerNameTag(name string) string {
+	return runnerNameTagPrefix + name
+}
+
+// withRunnerNameTag returns the configured tags with the runner name tag appended
+func (r *RunnerConfig) withRunnerNameTag(name string) []string {
+	var tags []string
+	if r.Tags != nil {
+		tags = append(tags, *r.Tags...)
+	}
+	return append(tags, runnerNameTag(name))
+}
+
+// tagVolumes tags the volumes of the created server with the runner name, volumes are created with the
+// server and the create request can not tag them
+func (r *RunnerConfig) tagVolumes(ctx context.Context, client *scw.Client, name string, server *instance.Server) error {
+	for _, volume := range server.Volumes {
+		log.DebugF("tagging the volume %q of the runner %q", volume.ID, name)
+		if err := r.tagVolume(ctx, client, volume.ID, r.withRunnerNameTag(name)); err != nil {
+			return fmt.Errorf("failed tagging the volume %q: %w", volume.ID, err)
+		}
+	}
+	return nil
+}
+
+// releaseResources removes the server and everything created for it, the flexible IPs and the volumes
+// are not removed with the server so they are released explicitly, server can be nil in which case
+// only the leftovers tagged with the runner name are released
+func (r *RunnerConfig) releaseResources(ctx context.Context, client *scw.Client, name string, server *instance.Server) error {
+	var messages []string
+	if server != nil {
+		if err := r.removeServer(client, server); err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+
+	if err := r.releaseIPs(ctx, client, name, server); err != nil {
+		messages = append(messages, err.Error())
+	}
+	if err := r.releaseVolumes(ctx, client, name, server); err != nil {
+		messages = append(messages, err.Error())
+	}
+
+	if len(messages) > 0 {
+		return errors.New(strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+// removeServer terminates the running server, stopped server can not be terminated so it is deleted instead
+func (r *RunnerConfig) removeServer(client *scw.Client, server *instance.Server) error {
+	if server.State != instance.ServerStateStopped {
+		return r.terminateInstance(client, server)
+	}
+
+	log.DebugF("deleting the stopped instance %q", server.ID)
+	api := instance.NewAPI(client)
+	err := api.DeleteServer(&instance.DeleteServerRequest{
+		Zone:     scw.Zone(*r.Zone),
+		ServerID: server.ID,
+	})
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// releaseIPs deletes the flexible IPs tagged with the runner name and the flexible IP attached to the server
+func (r *RunnerConfig) releaseIPs(ctx context.Context, client *scw.Client, name string, server *instance.Server) error {
+	api := instance.NewAPI(client)
+
+	ips, err := r.listTaggedIPs(ctx, client, runnerNameTag(name))
+	if err != nil {
+		return err
+	}
+	ipIDs := make([]string, 0, len(ips)+1)
+	for _, ip := range ips {
+		ipIDs = append(ipIDs, ip.ID)
+	}
+	// dynamic IP goes away with the server
+	if server != nil && server.PublicIP != nil && !server.PublicIP.Dynamic {
+		ipIDs = appendUnique(ipIDs, server.PublicIP.ID)
+	}
+
+	for _, ipID := range ipIDs {
+		log.DebugF("releasing the IP %q of the runner %q", ipID, name)
+		err = api.DeleteIP(&instance.DeleteIPRequest{Zone: scw.Zone(*r.Zone), IP: ipID}, scw.WithContext(ctx))
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("failed releasing the IP %q: %w", ipID, err)
+		}
+	}
+	return nil
+}
+
+// releaseVolumes deletes the volumes tagged with the runner name and the volumes of the server
+func (r *RunnerConfig) releaseVolumes(ctx context.Context, client *scw.Client, name string, server *instance.Server) error {
+	volumes, err := r.listTaggedVolumes(ctx, client, runnerNameTag(name))
+	if err != nil {
+		return err
+	}
+	volumeIDs := make([]string, 0, len(volumes))
+	for _, volume := range volumes {
+		volumeIDs = append(volumeIDs, volume.ID)
+	}
+	// volumes of the server that failed before they were tagged
+	if server != nil {
+		for _, volume := range server.Volumes {
+			volumeIDs = appendUnique(volumeIDs, volume.ID)
+		}
+	}
+
+	var messages []string
+	for _, volumeID := range volumeIDs {
+		if err := r.releaseVolume(ctx, client, volumeID); err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+	if len(messages) > 0 {
+		return errors.New(strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+// appendUnique appends the value unless the slice holds it already
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// releaseVolume deletes the volume, volume removed together with the server is not an error
+func (r *RunnerConfig) releaseVolume(ctx context.Context, client *scw.Client, volumeID string) error {
+	api := instance.NewAPI(client)
+
+	err := api.DeleteVolume(&instance.DeleteVolumeRequest{Zone: scw.Zone(*r.Zone), VolumeID: volumeID}, scw.WithContext(ctx))
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed releasing the volume %q: %w", volumeID, err)
+	}
+	log.DebugF("released the volume %q", volumeID)
+	return nil
+}
+
+// isNotFound tells if the API responded with 404
+func isNotFound(err error) bool {
+	var notFound *scw.ResourceNotFoundError
+	if errors.As(err, &notFound) {
+		return true
+	}
+	var respErr *scw.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == 404
+}
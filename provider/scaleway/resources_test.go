@@ -0,0 +1,130 @@
+package scaleway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// fakeInstanceAPI serves the flexible IPs and the volumes of a zone, list calls filter by the tags
+// query the way the Scaleway API does
+type fakeInstanceAPI struct {
+	mu      sync.Mutex
+	tags    map[string][]string
+	deleted []string
+	lists   []string
+}
+
+func (f *fakeInstanceAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(req.URL.Path, "/instance/v1/zones/fr-par-1/")
+	parts := strings.Split(path, "/")
+	switch {
+	case req.Method == http.MethodGet && len(parts) == 1:
+		tag := req.URL.Query().Get("tags")
+		f.lists = append(f.lists, parts[0]+"?tags="+tag)
+		var ids []string
+		for id, tags := range f.tags {
+			if strings.HasPrefix(id, strings.TrimSuffix(parts[0], "s")) && contains(tags, tag) {
+				ids = append(ids, id)
+			}
+		}
+		items := make([]map[string]interface{}, 0, len(ids))
+		for _, id := range ids {
+			items = append(items, map[string]interface{}{"id": id, "tags": f.tags[id]})
+		}
+		writeJSON(w, map[string]interface{}{parts[0]: items, "total_count": len(items)})
+	case req.Method == http.MethodPatch && len(parts) == 2:
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.tags[parts[1]] = body.Tags
+		writeJSON(w, map[string]interface{}{"volume": map[string]interface{}{"id": parts[1]}})
+	case req.Method == http.MethodDelete && len(parts) == 2:
+		delete(f.tags, parts[1])
+		f.deleted = append(f.deleted, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected request "+req.Method+" "+req.URL.Path, http.StatusNotImplemented)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestClient(t *testing.T, handler http.Handler) *scw.Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := scw.NewClient(
+		scw.WithAPIURL(server.URL),
+		scw.WithAuth("SCWXXXXXXXXXXXXXXXXX", "11111111-1111-1111-1111-111111111111"),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error: %v", err)
+	}
+	return client
+}
+
+func TestReleaseResourcesByTag(t *testing.T) {
+	api := &fakeInstanceAPI{tags: map[string][]string{
+		"ip-runner":      {"team", runnerNameTag("runner-1")},
+		"ip-other":       {runnerNameTag("runner-2")},
+		"volume-other":   {runnerNameTag("runner-2")},
+		"volume-runner":  nil,
+		"volume-runner2": nil,
+	}}
+	client := newTestClient(t, api)
+	zone, project := "fr-par-1", "project"
+	r := &RunnerConfig{Zone: &zone, Access: &AccessConfig{ProjectID: &project}}
+
+	// volumes are tagged once the server is created
+	server := &instance.Server{ID: "server", Volumes: map[string]*instance.Volume{
+		"0": {ID: "volume-runner"},
+		"1": {ID: "volume-runner2"},
+	}}
+	if err := r.tagVolumes(context.Background(), client, "runner-1", server); err != nil {
+		t.Fatalf("tagVolumes() unexpected error: %v", err)
+	}
+
+	// server is gone already, leftovers are found by the tag alone
+	if err := r.releaseResources(context.Background(), client, "runner-1", nil); err != nil {
+		t.Fatalf("releaseResources() unexpected error: %v", err)
+	}
+
+	sort.Strings(api.deleted)
+	if want := []string{"ip-runner", "volume-runner", "volume-runner2"}; !reflect.DeepEqual(api.deleted, want) {
+		t.Errorf("deleted = %v, want %v", api.deleted, want)
+	}
+	tag := runnerNameTag("runner-1")
+	if want := []string{"ips?tags=" + tag, "volumes?tags=" + tag}; !reflect.DeepEqual(api.lists, want) {
+		t.Errorf("list calls = %v, want them filtered by the tag %v", api.lists, want)
+	}
+}
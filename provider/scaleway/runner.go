@@ -1,11 +1,16 @@
 package scaleway
 
-import "github.com/76creates/runner-cli/provider"
+import (
+	"errors"
+	"github.com/76creates/runner-cli/provider"
+	"github.com/76creates/runner-cli/secret"
+)
 
 // RunnerConfig configuration for the runner runner creation, it contains access/credentials for the
 // given provider thus you can use multiple keys/accounts for multiple different runner types
 type RunnerConfig struct {
 	provider.BaseProvider
+	provider.CloudInitConfig `mapstructure:",squash" yaml:",inline"`
 
 	Access *AccessConfig `mapstructure:"access" yaml:"access"`
 
@@ -14,14 +19,36 @@ type RunnerConfig struct {
 	Zone *string `mapstructure:"zone" yaml:"zone"`
 	SecurityGroup *string `mapstructure:"security-group" yaml:"security-group"`
 	Tags *[]string `mapstructure:"tags" yaml:"tags"`
-	CloudInit *string `mapstructure:"cloud-init" yaml:"cloud-init"`
+
+	// PublicIP ipv4, ipv6 or none, defaults to ipv4, instance without the public IPv4 needs the private
+	// network attached to the public gateway to reach GitHub
+	PublicIP *string `mapstructure:"public-ip" yaml:"public-ip"`
+	// PrivateNetwork ID of the private network the instance is attached to, public gateway of the network
+	// is used for egress
+	PrivateNetwork *string `mapstructure:"private-network" yaml:"private-network"`
+	// PlacementGroup ID of the placement group the instance is created in
+	PlacementGroup *string `mapstructure:"placement-group" yaml:"placement-group"`
 }
 
 // AccessConfig if needed provides access info for the provider to authentification, etc.
 // if "access method" is not needed for the provider this struct should be left empty
 type AccessConfig struct {
 	KeyID *string `mapstructure:"key_id" yaml:"key_id"`
-	KeySecret *string `mapstructure:"key_secret" yaml:"key_secret"`
+	KeySecret *secret.Secret `mapstructure:"key_secret" yaml:"key_secret"`
 	ProjectID *string `mapstructure:"project" yaml:"project"`
 	OrgID *string `mapstructure:"organisation" yaml:"organisation"`
+}
+
+// Validate checks the key is set together with the organisation or the project it is scoped to
+func (a *AccessConfig) Validate() error {
+	if a.KeyID == nil || *a.KeyID == "" {
+		return errors.New("key_id must be set")
+	}
+	if a.KeySecret == nil || a.KeySecret.Value() == "" {
+		return errors.New("key_secret must be set")
+	}
+	if (a.OrgID == nil || *a.OrgID == "") && (a.ProjectID == nil || *a.ProjectID == "") {
+		return errors.New("one of organisation or project must be set")
+	}
+	return nil
 }
\ No newline at end of file
@@ -2,45 +2,103 @@ package scaleway
 
 import (
 	"context"
-	"errors"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"github.com/76creates/runner-cli/ghCtl"
 	"github.com/76creates/runner-cli/log"
 	"github.com/76creates/runner-cli/provider"
 	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
 	"github.com/scaleway/scaleway-sdk-go/scw"
 	"io"
 	"strings"
+	"sync"
 	"time"
 )
 
-// getClient initialize and get Scaleway API
+var (
+	// clientCache holds the clients per credentials, client is safe for the concurrent use
+	clientCache = make(map[string]*scw.Client)
+	clientCacheMutex sync.Mutex
+)
+
+// getClient initialize and get Scaleway API, client is created once per credentials and reused
 func (r *RunnerConfig) getClient() (*scw.Client, error) {
+	key := r.accessKey()
+
+	clientCacheMutex.Lock()
+	defer clientCacheMutex.Unlock()
+	if client, ok := clientCache[key]; ok {
+		return client, nil
+	}
+
 	log.Debug("authenticating Scaleway client")
-	client, err := scw.NewClient(
-		// Get your credentials at https://console.scaleway.com/project/credentials
-		scw.WithDefaultOrganizationID(*r.Access.OrgID),
-		scw.WithAuth(*r.Access.KeyID, *r.Access.KeySecret),
-	)
+	// Get your credentials at https://console.scaleway.com/project/credentials
+	opts := []scw.ClientOption{scw.WithAuth(value(r.Access.KeyID), r.Access.KeySecret.Value())}
+	// project only credentials have no organisation
+	if value(r.Access.OrgID) != "" {
+		opts = append(opts, scw.WithDefaultOrganizationID(*r.Access.OrgID))
+	}
+	if value(r.Access.ProjectID) != "" {
+		opts = append(opts, scw.WithDefaultProjectID(*r.Access.ProjectID))
+	}
+	client, err := scw.NewClient(opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	log.Debug("successfully authenticated Scaleway client")
+	clientCache[key] = client
 	return client, nil
 }
 
+// accessKey identifies the credentials, secret key is hashed
+func (r *RunnerConfig) accessKey() string {
+	secretKey := ""
+	if r.Access.KeySecret != nil {
+		secretKey = r.Access.KeySecret.Value()
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%s",
+		value(r.Access.OrgID), value(r.Access.ProjectID), value(r.Access.KeyID), secretKey)))
+	return hex.EncodeToString(sum[:])
+}
+
+// value returns the value of the optional string, empty if it is not set
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// closeClients drops the cached clients, scw client holds no resources that need closing
+func closeClients() error {
+	clientCacheMutex.Lock()
+	defer clientCacheMutex.Unlock()
+	clientCache = make(map[string]*scw.Client)
+	return nil
+}
+
+func init() {
+	provider.RegisterCloser(closeClients)
+}
+
+// scope returns the organisation and the project the resources are created and looked up in, project
+// takes precedence, without it the organisation is used which resolves to its default project on create
+func (r *RunnerConfig) scope() (organization *string, project *string) {
+	if r.Access.ProjectID != nil && *r.Access.ProjectID != "" {
+		return nil, r.Access.ProjectID
+	}
+	return r.Access.OrgID, nil
+}
+
 // createInstance creates new scaleway instance, this instance is bare and stopped after this action
 func (r *RunnerConfig) createInstance(ctx context.Context, client *scw.Client, name string) (*instance.Server, error) {
 	log.Debug("creating scaleway instance")
 
 	api := instance.NewAPI(client)
 
-	project := r.Access.ProjectID
-	if project != nil {
-		project = r.Access.OrgID
-	}
-	dynamicIP := true
+	organization, project := r.scope()
+	dynamicIP := r.GetPublicIP() == PublicIPv4
 
 	request := instance.CreateServerRequest{
 		Zone:              scw.Zone(*r.Zone),
@@ -48,13 +106,15 @@ func (r *RunnerConfig) createInstance(ctx context.Context, client *scw.Client, n
 		DynamicIPRequired: &dynamicIP,
 		CommercialType:    *r.InstanceType,
 		Image:             *r.Image,
+		Organization:      organization,
 		Project:           project,
+		Tags:              r.withRunnerNameTag(name),
 	}
 	if r.SecurityGroup != nil {
 		request.SecurityGroup = r.SecurityGroup
 	}
-	if r.Tags != nil {
-		request.Tags = *r.Tags
+	if r.PlacementGroup != nil {
+		request.PlacementGroup = r.PlacementGroup
 	}
 
 	resp, err := api.CreateServer(&request, scw.WithContext(ctx))
@@ -65,23 +125,19 @@ func (r *RunnerConfig) createInstance(ctx context.Context, client *scw.Client, n
 	return resp.Server, nil
 }
 
-// attachPublicIPv4 adds cloud init user data to be ran at the instance startup
-func (r *RunnerConfig) attachPublicIPv4(ctx context.Context, client *scw.Client, serverID string) (*instance.IP, error) {
+// attachPublicIPv4 creates the flexible IPv4 attached to the server
+func (r *RunnerConfig) attachPublicIPv4(ctx context.Context, client *scw.Client, name, serverID string) (*instance.IP, error) {
 	log.Debug("attaching IPv4 to the instance instance")
 
 	api := instance.NewAPI(client)
 
-	project := r.Access.ProjectID
-	if project != nil {
-		project = r.Access.OrgID
-	}
+	organization, project := r.scope()
 	request := instance.CreateIPRequest{
 		Zone:         scw.Zone(*r.Zone),
+		Organization: organization,
 		Project:      project,
 		Server:       &serverID,
-	}
-	if r.Tags != nil {
-		request.Tags = *r.Tags
+		Tags:         r.withRunnerNameTag(name),
 	}
 
 	resp, err := api.CreateIP(&request, scw.WithContext(ctx))
@@ -109,27 +165,27 @@ func (r *RunnerConfig) addCloudInit(ctx context.Context, client *scw.Client, ser
 }
 
 func (r *RunnerConfig) parseCloudData(ctx context.Context, runnerName, runnerID string) (*io.Reader, error) {
-	if r.CloudInit == nil {
+	if !r.HasCloudInit() {
 		log.Warning("cloud init is null, nothing to parse")
 		return nil, nil
 	}
 	log.Debug("parsing cloud init")
 
-	cloudInitData := provider.CloudInitData {
-		GithubRepo: fmt.Sprintf("%s/%s", ghCtl.GetRepoOwner(ctx), ghCtl.GetRepoName(ctx)),
-		GithubRunnerName: runnerName,
-		GithubRunnerToken: r.GithubRegistrationToken,
-		GithubRunnerType: r.RunnerType,
-		GithubRunnerUniqueID: runnerID,
-	}
-	cloudInitParsed, err := provider.ParseCloudInit(*r.CloudInit, cloudInitData)
+	cloudInitData := r.BuildCloudInitData(runnerName, runnerID)
+	cloudInitParsed, err := r.RenderUserData(cloudInitData)
 	if err != nil {
 		log.Error(err.Error())
 		return nil, err
 	}
 
+	userData := *cloudInitParsed
+	// cloudbase-init needs a header to know the user data is a powershell script
+	if r.GetUserDataFormat() == provider.UserDataFormatPowerShell {
+		userData = provider.WithPowerShellHeader(userData)
+	}
+
 	var reader io.Reader
-	reader = strings.NewReader(*cloudInitParsed)
+	reader = strings.NewReader(userData)
 
 	return &reader, nil
 }
@@ -152,59 +208,41 @@ func (r *RunnerConfig) startServerAndWait(client *scw.Client, serverID string) e
 	return api.ServerActionAndWait(&request)
 }
 
-// getServerByName lists servers by name, it will then check if there is a name that is an
-// exact match since on the Scaleway side it works more like "contains" than "is"
+// getServerByName looks up the server by the runner name tag, Scaleway name filter works more like
+// "contains" than "is" so the name is matched exactly on top of it, nil is returned if there is no server
 func (r *RunnerConfig) getServerByName(ctx context.Context, client *scw.Client, name string) (*instance.Server, error) {
 	log.DebugF("looking up server object with name %q", name)
 
 	api := instance.NewAPI(client)
 
-	project := r.Access.ProjectID
-	if project != nil {
-		project = r.Access.OrgID
-	}
-	var perPage uint32 = 100
+	organization, project := r.scope()
 	request := instance.ListServersRequest{
-		Zone:           scw.Zone(*r.Zone),
-		PerPage:        &perPage,
-		// TODO: enable pagination
-		//Page:           nil,
-		Project:        project,
-		Name:           &name,
-	}
-	if r.Tags != nil {
-		request.Tags = *r.Tags
+		Zone:         scw.Zone(*r.Zone),
+		Organization: organization,
+		Project:      project,
+		Name:         &name,
+		Tags:         []string{runnerNameTag(name)},
 	}
 
-	resp, err := api.ListServers(&request, scw.WithContext(ctx))
+	resp, err := api.ListServers(&request, scw.WithContext(ctx), scw.WithAllPages())
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.TotalCount == 0 {
-		log.WarningF("found 0 servers containing %q", name)
-		return nil, nil
-	}
-
-	if resp.TotalCount == 1 {
-		if resp.Servers[0].Name == name {
-			return resp.Servers[0], nil
-		}
-		return nil, errors.New(fmt.Sprintf("failed exact matching server with name %q", name))
-	}
-
-	// here we check for the exact name match as per Scaleway API:
-	// "server1" will return "server100" and "server1"
-	log.Warning("matched multiple servers, attempting to find the right one")
-	found := 0
 	var server *instance.Server
 	for _, s := range resp.Servers {
-		if s.Name == name {
-			if found > 1 {
-				return nil, errors.New(fmt.Sprintf("matched multiple servers with the name %q", name))
-			}
-			server = s
+		if s.Name != name {
+			continue
 		}
+		if server != nil {
+			return nil, fmt.Errorf("matched multiple servers with the name %q: %q and %q", name, server.ID, s.ID)
+		}
+		server = s
+	}
+
+	if server == nil {
+		log.WarningF("found 0 servers with the name %q", name)
+		return nil, nil
 	}
 
 	log.Debug("successfully matched one server by name")
@@ -214,6 +252,9 @@ func (r *RunnerConfig) getServerByName(ctx context.Context, client *scw.Client,
 // terminateInstance sends terminate call and waits for it to execute
 // it will timeout after 2 minutes
 func (r *RunnerConfig) terminateInstance(client *scw.Client, server *instance.Server) error {
+	if server == nil {
+		return nil
+	}
 	log.DebugF("sending terminate action to the instance %q", server.ID)
 
 	api := instance.NewAPI(client)
@@ -0,0 +1,213 @@
+package scaleway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/76creates/runner-cli/secret"
+)
+
+// fakeServersAPI serves the server list of a zone page by page, name filter matches the names
+// containing it the way the Scaleway API does
+type fakeServersAPI struct {
+	mu      sync.Mutex
+	servers []map[string]interface{}
+	queries []map[string]string
+}
+
+func (f *fakeServersAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if req.Method != http.MethodGet || req.URL.Path != "/instance/v1/zones/fr-par-1/servers" {
+		http.Error(w, "unexpected request "+req.Method+" "+req.URL.Path, http.StatusNotImplemented)
+		return
+	}
+	query := req.URL.Query()
+	f.queries = append(f.queries, map[string]string{
+		"name":         query.Get("name"),
+		"tags":         query.Get("tags"),
+		"organization": query.Get("organization"),
+		"project":      query.Get("project"),
+		"page":         query.Get("page"),
+	})
+
+	var matched []map[string]interface{}
+	for _, s := range f.servers {
+		if strings.Contains(s["name"].(string), query.Get("name")) {
+			matched = append(matched, s)
+		}
+	}
+	page, perPage := 1, 50
+	if p, err := strconv.Atoi(query.Get("page")); err == nil {
+		page = p
+	}
+	if p, err := strconv.Atoi(query.Get("per_page")); err == nil {
+		perPage = p
+	}
+	start, end := (page-1)*perPage, page*perPage
+	if start > len(matched) {
+		start = len(matched)
+	}
+	if end > len(matched) {
+		end = len(matched)
+	}
+	writeJSON(w, map[string]interface{}{"servers": matched[start:end], "total_count": len(matched)})
+}
+
+func testServers(names ...string) []map[string]interface{} {
+	servers := make([]map[string]interface{}, 0, len(names))
+	for i, name := range names {
+		servers = append(servers, map[string]interface{}{"id": fmt.Sprintf("server-%d", i), "name": name})
+	}
+	return servers
+}
+
+func TestGetServerByNameScope(t *testing.T) {
+	tests := []struct {
+		name             string
+		access           *AccessConfig
+		wantOrganization string
+		wantProject      string
+	}{
+		{name: "organisation", access: &AccessConfig{OrgID: strPtr("org")}, wantOrganization: "org"},
+		{name: "project", access: &AccessConfig{ProjectID: strPtr("project")}, wantProject: "project"},
+		{name: "project takes precedence", access: &AccessConfig{OrgID: strPtr("org"), ProjectID: strPtr("project")}, wantProject: "project"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeServersAPI{servers: testServers("runner-1")}
+			client := newTestClient(t, api)
+
+			r := &RunnerConfig{Zone: strPtr("fr-par-1"), Access: tt.access}
+			server, err := r.getServerByName(context.Background(), client, "runner-1")
+			if err != nil {
+				t.Fatalf("getServerByName() unexpected error: %v", err)
+			}
+			if server == nil || server.ID != "server-0" {
+				t.Fatalf("getServerByName() = %v, want server-0", server)
+			}
+
+			query := api.queries[0]
+			if query["organization"] != tt.wantOrganization || query["project"] != tt.wantProject {
+				t.Errorf("servers were listed in the organisation %q and the project %q, want %q and %q",
+					query["organization"], query["project"], tt.wantOrganization, tt.wantProject)
+			}
+			if query["name"] != "runner-1" || query["tags"] != runnerNameTag("runner-1") {
+				t.Errorf("servers were listed by the name %q and the tags %q, want the runner name and its tag", query["name"], query["tags"])
+			}
+		})
+	}
+}
+
+func TestGetServerByName(t *testing.T) {
+	// name filter of the API also matches runner-1-0 to runner-1-119, runner-1 is the last one on the third page
+	var names []string
+	for i := 0; i < 120; i++ {
+		names = append(names, fmt.Sprintf("runner-1-%d", i))
+	}
+
+	tests := []struct {
+		name      string
+		servers   []string
+		wantID    string
+		wantPages int
+		wantErr   string
+	}{
+		{name: "exact name among the similar ones", servers: append(append([]string{}, names...), "runner-1"), wantID: "server-120", wantPages: 3},
+		{name: "not found", servers: names, wantPages: 3},
+		{name: "duplicate name", servers: []string{"runner-1", "runner-10", "runner-1"}, wantErr: "matched multiple servers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeServersAPI{servers: testServers(tt.servers...)}
+			client := newTestClient(t, api)
+
+			r := &RunnerConfig{Zone: strPtr("fr-par-1"), Access: &AccessConfig{ProjectID: strPtr("project")}}
+			server, err := r.getServerByName(context.Background(), client, "runner-1")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("getServerByName() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getServerByName() unexpected error: %v", err)
+			}
+			if tt.wantID == "" && server != nil {
+				t.Errorf("getServerByName() = %q, want no server", server.ID)
+			}
+			if tt.wantID != "" && (server == nil || server.ID != tt.wantID) {
+				t.Errorf("getServerByName() = %v, want %q", server, tt.wantID)
+			}
+			if len(api.queries) != tt.wantPages {
+				t.Errorf("listed %d page(s) of the servers, want %d", len(api.queries), tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestGetClientWithoutOrganization(t *testing.T) {
+	defer func() {
+		if err := closeClients(); err != nil {
+			t.Errorf("closeClients() unexpected error: %v", err)
+		}
+	}()
+
+	keySecret := secret.Secret("11111111-1111-1111-1111-111111111111")
+	project := &RunnerConfig{Access: &AccessConfig{
+		KeyID:     strPtr("SCWXXXXXXXXXXXXXXXXX"),
+		KeySecret: &keySecret,
+		ProjectID: strPtr("22222222-2222-2222-2222-222222222222"),
+	}}
+	client, err := project.getClient()
+	if err != nil {
+		t.Fatalf("getClient() unexpected error: %v", err)
+	}
+	if _, ok := client.GetDefaultOrganizationID(); ok {
+		t.Error("project only client has the default organisation")
+	}
+	if id, ok := client.GetDefaultProjectID(); !ok || id != "22222222-2222-2222-2222-222222222222" {
+		t.Errorf("client default project = %q, want the configured one", id)
+	}
+
+	organisation := &RunnerConfig{Access: &AccessConfig{
+		KeyID:     strPtr("SCWXXXXXXXXXXXXXXXXX"),
+		KeySecret: &keySecret,
+		OrgID:     strPtr("22222222-2222-2222-2222-222222222222"),
+	}}
+	if project.accessKey() == organisation.accessKey() {
+		t.Error("project and organisation scoped credentials share the client")
+	}
+}
+
+func TestAccessConfigValidate(t *testing.T) {
+	keySecret := secret.Secret("secret")
+	tests := []struct {
+		name    string
+		access  AccessConfig
+		wantErr bool
+	}{
+		{name: "organisation", access: AccessConfig{KeyID: strPtr("key"), KeySecret: &keySecret, OrgID: strPtr("org")}},
+		{name: "project", access: AccessConfig{KeyID: strPtr("key"), KeySecret: &keySecret, ProjectID: strPtr("project")}},
+		{name: "no scope", access: AccessConfig{KeyID: strPtr("key"), KeySecret: &keySecret}, wantErr: true},
+		{name: "no key id", access: AccessConfig{KeySecret: &keySecret, OrgID: strPtr("org")}, wantErr: true},
+		{name: "no key secret", access: AccessConfig{KeyID: strPtr("key"), ProjectID: strPtr("project")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.access.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs is the function library available within the cloud-init templates,
+// functions follow the Sprig naming and argument order so pipelines read the same
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"b64enc":     b64enc,
+		"indent":     indent,
+		"nindent":    nindent,
+		"toYaml":     toYaml,
+		"env":        os.Getenv,
+		"default":    defaultValue,
+		"quote":      quote,
+		"shellQuote": shellQuote,
+		"required":   required,
+		"join":       join,
+	}
+}
+
+// b64enc base64 encodes the value
+func b64enc(v interface{}) string {
+	return base64.StdEncoding.EncodeToString([]byte(toString(v)))
+}
+
+// indent pads every line of the value with the number of spaces
+func indent(spaces int, v interface{}) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(toString(v), "\n", "\n"+pad)
+}
+
+// nindent same as indent but starts with a new line, handy for yaml blocks
+func nindent(spaces int, v interface{}) string {
+	return "\n" + indent(spaces, v)
+}
+
+// toYaml encodes the value as yaml without the trailing new line
+func toYaml(v interface{}) (string, error) {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// defaultValue returns the given value unless it is empty, in that case default is returned
+// usage: {{ .Value | default "foo" }}
+func defaultValue(def interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || isEmpty(given[0]) {
+		return def
+	}
+	return given[0]
+}
+
+// quote wraps the value in double quotes, escaping it as a Go/YAML double quoted string
+func quote(v interface{}) string {
+	return strconv.Quote(toString(v))
+}
+
+// shellQuote wraps the value in single quotes so it is passed to the shell as is
+func shellQuote(v interface{}) string {
+	return "'" + strings.ReplaceAll(toString(v), "'", `'\''`) + "'"
+}
+
+// join joins the list items with the separator
+// usage: {{ .GithubRunnerLabels | join "," }}
+func join(sep string, v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if v == nil || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+		return toString(v)
+	}
+	items := make([]string, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		items[i] = toString(rv.Index(i).Interface())
+	}
+	return strings.Join(items, sep)
+}
+
+// required fails the rendering with the message if the value is empty
+func required(message string, v interface{}) (interface{}, error) {
+	if isEmpty(v) {
+		return nil, errors.New(message)
+	}
+	return v, nil
+}
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return true
+		}
+		return isEmpty(rv.Elem().Interface())
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	default:
+		return rv.IsZero()
+	}
+}
@@ -0,0 +1,62 @@
+{{- define "runner-install.sh" -}}
+#!/bin/bash
+set -euo pipefail
+
+{{- $version := index .Vars "runner_version" | default "2.311.0" }}
+{{- $arch := index .Vars "runner_arch" | default "x64" }}
+{{- $sha256 := index .Vars "runner_sha256" }}
+{{- /* the default runner supports --jitconfig, its archive checksum is pinned, any other version or arch must provide its own */}}
+{{- if and (not $sha256) (eq $version "2.311.0") (eq $arch "x64") }}
+{{- $sha256 = "29fc8cf2dab4c195bb147384e7e2c94cfd4d4022c793b346a6175435265aa278" }}
+{{- end }}
+
+RUNNER_VERSION={{ $version | shellQuote }}
+RUNNER_ARCH={{ $arch | shellQuote }}
+RUNNER_SHA256={{ required "runner_sha256 var must be set to the checksum of the runner archive when runner_version or runner_arch is overridden" $sha256 | shellQuote }}
+RUNNER_USER=runner
+RUNNER_DIR=/home/${RUNNER_USER}/actions-runner
+
+{{- if .GithubCABundle }}
+# CA bundle of the GitHub enterprise server, trusted system wide and by the node based actions
+mkdir -p /usr/local/share/ca-certificates
+cat > /usr/local/share/ca-certificates/gh-runner-ctl.crt <<'GH_RUNNER_CTL_CA_BUNDLE'
+{{ .GithubCABundle }}
+GH_RUNNER_CTL_CA_BUNDLE
+update-ca-certificates
+{{- end }}
+
+id -u "${RUNNER_USER}" >/dev/null 2>&1 || useradd --create-home --shell /bin/bash "${RUNNER_USER}"
+mkdir -p "${RUNNER_DIR}"
+cd "${RUNNER_DIR}"
+
+curl --fail --silent --show-error --location --output runner.tar.gz \
+  "https://github.com/actions/runner/releases/download/v${RUNNER_VERSION}/actions-runner-linux-${RUNNER_ARCH}-${RUNNER_VERSION}.tar.gz"
+echo "${RUNNER_SHA256}  runner.tar.gz" | sha256sum --check --strict -
+tar xzf runner.tar.gz
+rm runner.tar.gz
+./bin/installdependencies.sh
+{{- if .GithubCABundle }}
+echo "NODE_EXTRA_CA_CERTS=/usr/local/share/ca-certificates/gh-runner-ctl.crt" >> .env
+{{- end }}
+chown -R "${RUNNER_USER}:${RUNNER_USER}" "${RUNNER_DIR}"
+
+{{- if .GithubRunnerJITConfig }}
+# just-in-time configured runner runs a single job and exits
+sudo -u "${RUNNER_USER}" nohup ./run.sh --jitconfig {{ .GithubRunnerJITConfig | shellQuote }} >"${RUNNER_DIR}/run.log" 2>&1 &
+{{- else }}
+sudo -u "${RUNNER_USER}" ./config.sh --unattended \
+{{- if .GithubRunnerEphemeral }}
+  --ephemeral \
+{{- end }}
+{{- if .GithubRunnerGroup }}
+  --runnergroup {{ .GithubRunnerGroup | shellQuote }} \
+{{- end }}
+  --url {{ .GithubRegistrationURL | shellQuote }} \
+  --token {{ .GithubRunnerToken | shellQuote }} \
+  --name {{ .GithubRunnerName | shellQuote }} \
+  --labels {{ .GithubRunnerLabels | join "," | shellQuote }}
+
+./svc.sh install "${RUNNER_USER}"
+./svc.sh start
+{{- end }}
+{{- end -}}
@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// UserDataFormatCloudInit user data is passed to cloud-init as is, this is the default
+	UserDataFormatCloudInit = "cloud-init"
+	// UserDataFormatIgnition template is a Butane config that is converted into the Ignition JSON
+	UserDataFormatIgnition = "ignition"
+	// UserDataFormatPowerShell template is a PowerShell script ran by cloudbase-init or the GCE agent
+	UserDataFormatPowerShell = "powershell"
+)
+
+// PowerShellHeader tells cloudbase-init to run the user data with the 64bit PowerShell
+const PowerShellHeader = "#ps1_sysnative"
+
+// GetUserDataFormat returns the configured user data format
+func (c *CloudInitConfig) GetUserDataFormat() string {
+	if c.UserDataFormat == nil || *c.UserDataFormat == "" {
+		return UserDataFormatCloudInit
+	}
+	return *c.UserDataFormat
+}
+
+// validateUserDataFormat checks the format is known and that the templates can be used with it
+func (c *CloudInitConfig) validateUserDataFormat() error {
+	switch c.GetUserDataFormat() {
+	case UserDataFormatCloudInit:
+		return nil
+	case UserDataFormatIgnition, UserDataFormatPowerShell:
+		if len(c.parts) > 1 {
+			return fmt.Errorf("%s user data does not support multiple parts", c.GetUserDataFormat())
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown user data format %q", c.GetUserDataFormat())
+	}
+}
+
+// RenderUserData renders the templates and converts them into the user data of the configured format,
+// output is validated so a broken user data is never sent to the provider
+func (c *CloudInitConfig) RenderUserData(cloudInitData CloudInitData) (*string, error) {
+	rendered, err := c.RenderCloudInit(cloudInitData)
+	if err != nil || rendered == nil {
+		return rendered, err
+	}
+
+	switch c.GetUserDataFormat() {
+	case UserDataFormatIgnition:
+		userData, err := butaneToIgnition(*rendered)
+		if err != nil {
+			return nil, err
+		}
+		if err = validateIgnition(*userData); err != nil {
+			return nil, err
+		}
+		return userData, nil
+	case UserDataFormatPowerShell:
+		if err = validatePowerShell(*rendered); err != nil {
+			return nil, err
+		}
+		return rendered, nil
+	default:
+		if err = validateCloudInit(*rendered); err != nil {
+			return nil, err
+		}
+		return rendered, nil
+	}
+}
+
+// validateCloudInit checks that the cloud-config is a valid yaml, other cloud-init formats are passed as is
+func validateCloudInit(userData string) error {
+	if !strings.HasPrefix(userData, "#cloud-config") {
+		return nil
+	}
+	var config map[interface{}]interface{}
+	if err := yaml.Unmarshal([]byte(userData), &config); err != nil {
+		return fmt.Errorf("invalid cloud-config yaml: %w", err)
+	}
+	return nil
+}
+
+// validatePowerShell makes sure there is an actual script to run
+func validatePowerShell(userData string) error {
+	script := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(userData), PowerShellHeader))
+	if script == "" {
+		return errors.New("powershell user data is empty")
+	}
+	if !utf8.ValidString(script) {
+		return errors.New("powershell user data is not valid utf-8")
+	}
+	return nil
+}
+
+// WithPowerShellHeader prefixes the script with the cloudbase-init header if it is missing
+func WithPowerShellHeader(script string) string {
+	if strings.HasPrefix(strings.TrimSpace(script), PowerShellHeader) {
+		return script
+	}
+	return PowerShellHeader + "\n" + script
+}
@@ -0,0 +1,93 @@
+package secret
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	registryMu sync.RWMutex
+	// registry counts the registrations of the value so the value shared by multiple owners stays
+	// redacted until all of them deregister it
+	registry   = make(map[string]int)
+)
+
+// Secret holds a sensitive value such as an access key, it is never printed in its raw form,
+// use Value to get the actual content
+type Secret string
+
+// String implements fmt.Stringer, it always returns the redacted placeholder
+func (s Secret) String() string { return redacted }
+
+// GoString implements fmt.GoStringer so %#v does not leak the value either
+func (s Secret) GoString() string { return redacted }
+
+// Value returns the raw secret value
+func (s Secret) Value() string { return string(s) }
+
+// MarshalYAML makes sure secret is not leaked when the config is dumped
+func (s Secret) MarshalYAML() (interface{}, error) { return redacted, nil }
+
+// MarshalJSON makes sure secret is not leaked when the config is dumped
+func (s Secret) MarshalJSON() ([]byte, error) { return []byte(fmt.Sprintf("%q", redacted)), nil }
+
+// UnmarshalYAML decodes the secret and registers its value for redaction
+func (s *Secret) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v string
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	*s = Secret(v)
+	Register(v)
+	return nil
+}
+
+// Register marks the value as sensitive, every occurrence of it will be replaced by Redact
+func Register(value string) {
+	// very short values would redact half of the output, they are not worth protecting anyhow
+	if len(value) < 4 {
+		return
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[value]++
+}
+
+// Deregister drops the registration of the short lived value such as the runner registration token,
+// value is no longer redacted once every registration of it is dropped
+func Deregister(value string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[value]; !ok {
+		return
+	}
+	registry[value]--
+	if registry[value] <= 0 {
+		delete(registry, value)
+	}
+}
+
+// Redact replaces all registered secret values in the content with a placeholder
+func Redact(content string) string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if len(registry) == 0 {
+		return content
+	}
+
+	// replace longest values first in case one secret contains the other
+	values := make([]string, 0, len(registry))
+	for v := range registry {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	for _, v := range values {
+		content = strings.ReplaceAll(content, v, redacted)
+	}
+	return content
+}
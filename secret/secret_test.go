@@ -0,0 +1,104 @@
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestSecretIsNeverPrinted(t *testing.T) {
+	s := Secret("super-secret-value")
+
+	if got := s.String(); got != redacted {
+		t.Errorf("String() = %q, want %q", got, redacted)
+	}
+	if got := fmt.Sprintf("%v %s %#v", s, s, s); strings.Contains(got, s.Value()) {
+		t.Errorf("formatted secret leaked the value: %q", got)
+	}
+
+	out, err := yaml.Marshal(map[string]Secret{"key": s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), s.Value()) || !strings.Contains(string(out), redacted) {
+		t.Errorf("MarshalYAML leaked the value: %q", out)
+	}
+
+	out, err = json.Marshal(map[string]Secret{"key": s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"key":"`+redacted+`"}` {
+		t.Errorf("MarshalJSON = %s", out)
+	}
+}
+
+func TestUnmarshalYAMLRegistersValue(t *testing.T) {
+	var cfg struct {
+		Key Secret `yaml:"key"`
+	}
+	if err := yaml.Unmarshal([]byte("key: unmarshalled-secret"), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer Deregister("unmarshalled-secret")
+
+	if cfg.Key.Value() != "unmarshalled-secret" {
+		t.Errorf("Value() = %q", cfg.Key.Value())
+	}
+	if got := Redact("token is unmarshalled-secret"); got != "token is "+redacted {
+		t.Errorf("Redact() = %q", got)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	Register("abc")
+	Register("registered-token")
+	Register("registered-token-long")
+	defer Deregister("registered-token")
+	defer Deregister("registered-token-long")
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"nothing to hide", "nothing to hide"},
+		{"short abc values are not redacted", "short abc values are not redacted"},
+		{"--token registered-token", "--token " + redacted},
+		// longer secret containing the shorter one is redacted as a whole
+		{"--token registered-token-long", "--token " + redacted},
+		{"registered-token registered-token", redacted + " " + redacted},
+	}
+	for _, tt := range tests {
+		if got := Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDeregister(t *testing.T) {
+	Register("per-job-token")
+	Register("per-job-token")
+
+	Deregister("per-job-token")
+	if got := Redact("per-job-token"); got != redacted {
+		t.Errorf("value registered twice should stay redacted after one deregistration, got %q", got)
+	}
+
+	Deregister("per-job-token")
+	if got := Redact("per-job-token"); got != "per-job-token" {
+		t.Errorf("value should not be redacted after all registrations are dropped, got %q", got)
+	}
+
+	registryMu.RLock()
+	_, ok := registry["per-job-token"]
+	registryMu.RUnlock()
+	if ok {
+		t.Error("deregistered value is still in the registry")
+	}
+
+	// deregistering an unknown value is a no-op
+	Deregister("never-registered")
+}